@@ -0,0 +1,151 @@
+// Command couponbench compares the coupon backends on synthetic coupon
+// files from coupongen: load time, heap held after loading, lookup latency
+// and correctness against the generated ground truth.
+//
+//	go run ./cmd/couponbench -codes 1000000 -backends bloom,exact,mph
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	_ "order-food-api/core/cacheBitmap"
+	_ "order-food-api/core/cacheBloomFilter"
+	_ "order-food-api/core/cacheExact"
+	_ "order-food-api/core/cacheMPH"
+	_ "order-food-api/core/cacheMap"
+	_ "order-food-api/core/cacheSlice"
+	_ "order-food-api/core/cacheTrie"
+
+	"order-food-api/core/coupongen"
+	"order-food-api/core/couponindex"
+)
+
+const minFiles = 2
+
+func main() {
+	def := coupongen.DefaultConfig()
+	backends := flag.String("backends", "bitmap,bloom,exact,map,mph,slice,trie", "comma separated backends to compare")
+	codes := flag.Int("codes", 200_000, "lines per generated file")
+	overlap := flag.Float64("overlap", def.Overlap, "fraction of each file's codes also found in other files")
+	absent := flag.Int("absent", 1_000_000, "absent codes probed to measure the false positive rate")
+	seed := flag.Int64("seed", def.Seed, "random seed")
+	flag.Parse()
+
+	dir, err := os.MkdirTemp("", "couponbench-")
+	if err != nil {
+		log.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := def
+	cfg.CodesPerFile = *codes
+	cfg.Overlap = *overlap
+	cfg.Seed = *seed
+	corpus, err := coupongen.Generate(dir, cfg)
+	if err != nil {
+		log.Fatalf("Failed to generate coupon files: %v", err)
+	}
+
+	valid := corpus.AtLeast(minFiles)
+	absentCodes := corpus.Absent(*absent)
+	fmt.Printf("%d files x %d lines, %d valid codes, probing %d absent and %d single-file codes\n\n",
+		len(corpus.Files), *codes, len(valid), len(absentCodes), len(corpus.Singles))
+
+	fmt.Printf("%-8s %10s %10s %12s %12s %8s %10s %12s %12s %12s\n",
+		"backend", "load", "heap MB", "hit ns/op", "miss ns/op", "allocs", "false neg", "fp absent", "est absent", "fp single")
+	for _, name := range strings.Split(*backends, ",") {
+		if err := bench(name, corpus.Files, valid, absentCodes, corpus.Singles); err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+func bench(name string, paths, valid, absent, singles []string) error {
+	idx, err := couponindex.New(name)
+	if err != nil {
+		return err
+	}
+
+	before := heapAlloc()
+	start := time.Now()
+	if err := loadQuietly(idx, paths); err != nil {
+		return err
+	}
+	load := time.Since(start)
+	heapMB := float64(heapAlloc()-before) / 1024 / 1024
+
+	falseNeg := 0
+	for _, code := range valid {
+		if !idx.AppearsInAtLeastN(code, minFiles) {
+			falseNeg++
+		}
+	}
+	invalid := append(slices.Clip(absent), singles...)
+
+	hit := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			idx.AppearsInAtLeastN(valid[i%len(valid)], minFiles)
+		}
+	})
+	miss := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			idx.AppearsInAtLeastN(invalid[i%len(invalid)], minFiles)
+		}
+	})
+
+	estimate := "-"
+	if e, ok := idx.(couponindex.Estimator); ok {
+		estimate = fmt.Sprintf("%.2e", e.FalsePositiveRate(minFiles))
+	}
+
+	fmt.Printf("%-8s %10s %10.1f %12d %12d %8d %10d %12.2e %12s %12.2e\n",
+		name, load.Round(time.Millisecond), heapMB, hit.NsPerOp(), miss.NsPerOp(), hit.AllocsPerOp(),
+		falseNeg, acceptRate(idx, absent), estimate, acceptRate(idx, singles))
+
+	runtime.KeepAlive(idx)
+	return idx.Close()
+}
+
+// loadQuietly loads idx with stdout discarded, as loaders log every chunk.
+func loadQuietly(idx couponindex.Index, paths []string) error {
+	stdout := os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+	return idx.LoadFiles(paths)
+}
+
+func heapAlloc() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// acceptRate is the share of codes accepted by idx.
+func acceptRate(idx couponindex.Index, codes []string) float64 {
+	if len(codes) == 0 {
+		return 0
+	}
+	accepted := 0
+	for _, code := range codes {
+		if idx.AppearsInAtLeastN(code, minFiles) {
+			accepted++
+		}
+	}
+	return float64(accepted) / float64(len(codes))
+}
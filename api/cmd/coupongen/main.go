@@ -0,0 +1,81 @@
+// Command coupongen writes synthetic couponbase gz files and a ground truth
+// file listing the codes found in at least -min files.
+//
+//	go run ./cmd/coupongen -out ./files/synthetic -codes 5000000 -overlap 0.02
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"order-food-api/core/coupongen"
+)
+
+func main() {
+	def := coupongen.DefaultConfig()
+	out := flag.String("out", "./files/synthetic", "output directory")
+	files := flag.Int("files", def.Files, "number of files")
+	codes := flag.Int("codes", def.CodesPerFile, "lines per file")
+	alphabet := flag.String("alphabet", def.Alphabet, "characters codes are made of")
+	lengths := flag.String("lengths", "8:1,9:1,10:1", "code length weights as length:weight pairs")
+	overlap := flag.Float64("overlap", def.Overlap, "fraction of each file's codes also found in other files")
+	dups := flag.Float64("dup", def.Duplicates, "fraction of lines repeating a code of the same file")
+	noise := flag.Float64("noise", def.Noise, "fraction of lines that are not valid codes")
+	seed := flag.Int64("seed", def.Seed, "random seed; the same flags always produce the same files")
+	minFiles := flag.Int("min", 2, "ground truth lists codes found in at least this many files")
+	flag.Parse()
+
+	weights, err := parseLengths(*lengths)
+	if err != nil {
+		log.Fatalf("Invalid -lengths: %v", err)
+	}
+
+	cfg := coupongen.Config{
+		Files:        *files,
+		CodesPerFile: *codes,
+		Alphabet:     *alphabet,
+		Lengths:      weights,
+		Overlap:      *overlap,
+		Duplicates:   *dups,
+		Noise:        *noise,
+		Seed:         *seed,
+	}
+	corpus, err := coupongen.Generate(*out, cfg)
+	if err != nil {
+		log.Fatalf("Failed to generate coupon files: %v", err)
+	}
+
+	truth := filepath.Join(*out, "truth.txt")
+	if err := corpus.WriteTruth(truth, *minFiles); err != nil {
+		log.Fatalf("Failed to write ground truth: %v", err)
+	}
+
+	for _, f := range corpus.Files {
+		fmt.Println("Wrote", f)
+	}
+	fmt.Printf("Wrote %s with %d codes found in at least %d files\n", truth, len(corpus.AtLeast(*minFiles)), *minFiles)
+}
+
+func parseLengths(s string) (map[int]float64, error) {
+	weights := make(map[int]float64)
+	for _, pair := range strings.Split(s, ",") {
+		length, weight, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("%q is not length:weight", pair)
+		}
+		l, err := strconv.Atoi(length)
+		if err != nil {
+			return nil, err
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil {
+			return nil, err
+		}
+		weights[l] = w
+	}
+	return weights, nil
+}
@@ -0,0 +1,187 @@
+// Command couponprep turns the couponbase gz files into a compact sorted
+// artifact holding only the codes found in at least -min files, for the
+// "prepared" coupon backend.
+//
+// Each file is streamed, filtered to valid 8-10 char codes and sorted into
+// runs of at most -run-size keys on disk, so memory stays bounded no matter
+// how big the inputs are. The runs of all files are then k-way merged.
+//
+//	go run ./cmd/couponprep -out ./files/coupons.prep ./files/couponbase*.gz
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"order-food-api/core/cachePrepared"
+	"order-food-api/core/couponindex"
+	"order-food-api/core/couponkey"
+)
+
+const readChunkSize = 1 << 20
+
+type fileReport struct {
+	File    string `json:"file"`
+	Lines   int64  `json:"lines"`
+	Valid   int64  `json:"valid"`
+	Invalid int64  `json:"invalid"`
+	Runs    int    `json:"runs"`
+}
+
+type report struct {
+	Files       []fileReport  `json:"files"`
+	Distinct    int64         `json:"distinct"`
+	ByFileCount map[int]int64 `json:"byFileCount"`
+	MinFiles    int           `json:"minFiles"`
+	Written     int64         `json:"written"`
+	Output      string        `json:"output"`
+}
+
+func main() {
+	out := flag.String("out", "./files/coupons.prep", "artifact to write")
+	minFiles := flag.Int("min", 2, "keep codes found in at least this many files")
+	runSize := flag.Int("run-size", 8_000_000, "keys sorted in memory per run (8 bytes each)")
+	tmpDir := flag.String("tmp", "", "directory for sorted runs (default: system temp)")
+	reportPath := flag.String("report", "", "also write the report as JSON to this path")
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"./files/couponbase1.gz", "./files/couponbase2.gz", "./files/couponbase3.gz"}
+	}
+	if len(files) > couponkey.MaxFiles {
+		log.Fatalf("At most %d files are supported, got %d", couponkey.MaxFiles, len(files))
+	}
+	if *minFiles < 1 || *minFiles > len(files) {
+		log.Fatalf("-min must be between 1 and %d", len(files))
+	}
+
+	dir, err := os.MkdirTemp(*tmpDir, "couponprep-")
+	if err != nil {
+		log.Fatalf("Failed to create run directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	rep := report{ByFileCount: make(map[int]int64), MinFiles: *minFiles, Output: *out}
+	var runs []run
+	for i, file := range files {
+		fr, fileRuns, err := sortFile(file, i, dir, *runSize)
+		if err != nil {
+			log.Fatalf("Failed to sort %s: %v", file, err)
+		}
+		fmt.Printf("Sorted %s: %d lines, %d valid codes, %d runs\n", filepath.Base(file), fr.Lines, fr.Valid, fr.Runs)
+		rep.Files = append(rep.Files, fr)
+		runs = append(runs, fileRuns...)
+	}
+
+	if err := writeArtifact(*out, files, runs, &rep); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+
+	printReport(rep)
+	if *reportPath != "" {
+		b, _ := json.MarshalIndent(rep, "", "  ")
+		if err := os.WriteFile(*reportPath, b, 0644); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	}
+}
+
+// sortFile streams one gz file into sorted runs on disk.
+func sortFile(path string, src int, dir string, runSize int) (fileReport, []run, error) {
+	fr := fileReport{File: path}
+	var runs []run
+	var runErr error
+	keys := make([]uint64, 0, runSize)
+
+	flush := func() {
+		if len(keys) == 0 || runErr != nil {
+			return
+		}
+		var r run
+		r, runErr = writeRun(dir, src, keys)
+		runs = append(runs, r)
+		keys = keys[:0]
+	}
+
+	var tracker couponindex.Tracker
+	err := couponindex.ReadChunks(path, readChunkSize, &tracker, func(lines []string) {
+		for _, line := range lines {
+			fr.Lines++
+			key, ok := couponkey.Encode(strings.TrimSpace(line))
+			if !ok {
+				fr.Invalid++
+				continue
+			}
+			fr.Valid++
+			keys = append(keys, key)
+			if len(keys) >= runSize {
+				flush()
+			}
+		}
+	})
+	if err != nil {
+		return fr, nil, err
+	}
+	flush()
+
+	fr.Runs = len(runs)
+	return fr, runs, runErr
+}
+
+func writeArtifact(path string, files []string, runs []run, rep *report) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f)
+	}
+	w, err := cachePrepared.NewWriter(tmp, cachePrepared.Header{MinFiles: rep.MinFiles, Files: names})
+	if err != nil {
+		return err
+	}
+
+	err = mergeRuns(runs, func(key uint64, mask uint8) error {
+		count := bits.OnesCount8(mask)
+		rep.Distinct++
+		rep.ByFileCount[count]++
+		if count < rep.MinFiles {
+			return nil
+		}
+		return w.Add(couponkey.Pack(key, mask))
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	rep.Written = w.Count()
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func printReport(rep report) {
+	fmt.Printf("Distinct codes: %d\n", rep.Distinct)
+	for n := 1; n <= len(rep.Files); n++ {
+		fmt.Printf("  in %d file(s): %d\n", n, rep.ByFileCount[n])
+	}
+	fmt.Printf("Wrote %d codes found in at least %d files to %s\n", rep.Written, rep.MinFiles, rep.Output)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"slices"
+)
+
+// run is a sorted, deduplicated file of keys from one coupon file.
+type run struct {
+	path string
+	src  int
+}
+
+func writeRun(dir string, src int, keys []uint64) (run, error) {
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	f, err := os.CreateTemp(dir, "run-*.bin")
+	if err != nil {
+		return run{}, err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 1<<20)
+	var buf [8]byte
+	for _, k := range keys {
+		binary.LittleEndian.PutUint64(buf[:], k)
+		if _, err := w.Write(buf[:]); err != nil {
+			return run{}, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return run{}, err
+	}
+	return run{path: f.Name(), src: src}, f.Close()
+}
+
+type runReader struct {
+	f   *os.File
+	r   *bufio.Reader
+	key uint64
+	src int
+}
+
+func (rr *runReader) next() (bool, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(rr.r, buf[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	rr.key = binary.LittleEndian.Uint64(buf[:])
+	return true, nil
+}
+
+// mergeRuns k-way merges all runs and calls emit once per distinct key with
+// the bitmask of source files containing it. Memory use is one read buffer
+// per run.
+func mergeRuns(runs []run, emit func(key uint64, mask uint8) error) error {
+	h := make(readerHeap, 0, len(runs))
+	defer func() {
+		for _, rr := range h {
+			rr.f.Close()
+		}
+	}()
+
+	for _, r := range runs {
+		f, err := os.Open(r.path)
+		if err != nil {
+			return err
+		}
+		rr := &runReader{f: f, r: bufio.NewReaderSize(f, 64*1024), src: r.src}
+		ok, err := rr.next()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if !ok {
+			f.Close()
+			continue
+		}
+		h = append(h, rr)
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		key := h[0].key
+		var mask uint8
+		for h.Len() > 0 && h[0].key == key {
+			rr := h[0]
+			mask |= 1 << rr.src
+			ok, err := rr.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&h, 0)
+			} else {
+				rr.f.Close()
+				heap.Pop(&h)
+			}
+		}
+		if err := emit(key, mask); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type readerHeap []*runReader
+
+func (h readerHeap) Len() int           { return len(h) }
+func (h readerHeap) Less(i, j int) bool { return h[i].key < h[j].key }
+func (h readerHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *readerHeap) Push(x any)        { *h = append(*h, x.(*runReader)) }
+func (h *readerHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
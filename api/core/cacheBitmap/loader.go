@@ -1,18 +1,20 @@
-package cacheMap
+package cacheBitmap
 
 import (
-	"bufio"
-	"compress/gzip"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/RoaringBitmap/roaring/v2"
 	"github.com/cespare/xxhash/v2"
+
+	"order-food-api/core/couponindex"
 )
 
+const Name = "bitmap"
+
 const (
 	chunkSize   = 5_000_000
 	workerCount = 32
@@ -24,10 +26,28 @@ type fileChunk struct {
 }
 
 type Loader struct {
-	lineChan     chan fileChunk
-	wg           sync.WaitGroup
-	fileBitmaps  map[string]*roaring.Bitmap
+	lineChan    chan fileChunk
+	wg          sync.WaitGroup
+	fileBitmaps map[string]*roaring.Bitmap
+	// version counts the changes of fileBitmaps. Published bitmaps are never
+	// modified, only replaced.
+	version      uint64
 	fileBitmapsM sync.Mutex
+	rates        atomic.Pointer[bitmapRates]
+	codes        atomic.Int64
+	tracker      couponindex.Tracker
+}
+
+// bitmapRates caches the false positive rate of one version of the file
+// bitmaps, since it takes unions over every bitmap.
+type bitmapRates struct {
+	version uint64
+	n       int
+	rate    float64
+}
+
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
 }
 
 func New() *Loader {
@@ -38,57 +58,31 @@ func New() *Loader {
 }
 
 func (l *Loader) LoadFiles(files []string) error {
+	l.tracker.Begin(files)
+
 	for i := 0; i < workerCount; i++ {
 		l.wg.Add(1)
 		go l.worker()
 	}
 
+	var err error
 	for _, file := range files {
-		if err := l.loadFileChunks(file); err != nil {
-			return fmt.Errorf("load %s: %w", file, err)
+		if err = l.loadFileChunks(file); err != nil {
+			err = fmt.Errorf("load %s: %w", file, err)
+			break
 		}
 	}
 
 	close(l.lineChan)
 	l.wg.Wait()
-	return nil
+	l.tracker.Finish(err)
+	return err
 }
 
 func (l *Loader) loadFileChunks(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	r, err := gzip.NewReader(f)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	var chunk []string
-	for scanner.Scan() {
-		chunk = append(chunk, scanner.Text())
-		if len(chunk) >= chunkSize {
-			l.sendChunk(path, chunk)
-			chunk = chunk[:0]
-		}
-	}
-	if len(chunk) > 0 {
-		l.sendChunk(path, chunk)
-	}
-
-	return scanner.Err()
-}
-
-func (l *Loader) sendChunk(fileName string, lines []string) {
-	copyLines := make([]string, len(lines))
-	copy(copyLines, lines)
-	l.lineChan <- fileChunk{fileName: fileName, lines: copyLines}
+	return couponindex.ReadChunks(path, chunkSize, &l.tracker, func(lines []string) {
+		l.lineChan <- fileChunk{fileName: path, lines: lines}
+	})
 }
 
 func (l *Loader) worker() {
@@ -104,13 +98,13 @@ func (l *Loader) worker() {
 		}
 
 		l.fileBitmapsM.Lock()
-		existing, ok := l.fileBitmaps[chunk.fileName]
-		if ok {
-			existing.Or(bm)
-		} else {
-			l.fileBitmaps[chunk.fileName] = bm
+		if existing, ok := l.fileBitmaps[chunk.fileName]; ok {
+			bm = roaring.Or(existing, bm)
 		}
+		l.fileBitmaps[chunk.fileName] = bm
+		l.version++
 		l.fileBitmapsM.Unlock()
+		l.codes.Add(int64(len(chunk.lines)))
 
 		fmt.Printf("Processed chunk for %s with %d codes\n", filepath.Base(chunk.fileName), len(chunk.lines))
 	}
@@ -134,6 +128,72 @@ func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
 	return false
 }
 
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	l.fileBitmapsM.Lock()
+	defer l.fileBitmapsM.Unlock()
+
+	return couponindex.Stats{
+		Backend:    Name,
+		Files:      len(l.fileBitmaps),
+		Codes:      l.codes.Load(),
+		Structures: len(l.fileBitmaps),
+	}
+}
+
+// FalsePositiveRate is the share of the 32-bit hash space set in at least n
+// file bitmaps. Every file hashes codes the same way, so a colliding code
+// matches all files of the code it collides with; the file matches are not
+// independent and the rate is counted exactly instead. The rate is
+// computed once per version of the bitmaps, without holding the lock
+// lookups take.
+func (l *Loader) FalsePositiveRate(n int) float64 {
+	if n <= 0 {
+		return 1
+	}
+
+	l.fileBitmapsM.Lock()
+	version := l.version
+	bitmaps := make([]*roaring.Bitmap, 0, len(l.fileBitmaps))
+	for _, bm := range l.fileBitmaps {
+		bitmaps = append(bitmaps, bm)
+	}
+	l.fileBitmapsM.Unlock()
+
+	if cached := l.rates.Load(); cached != nil && cached.version == version && cached.n == n {
+		return cached.rate
+	}
+
+	// atLeast[j] holds the hashes set in more than j bitmaps seen so far.
+	atLeast := make([]*roaring.Bitmap, n)
+	for j := range atLeast {
+		atLeast[j] = roaring.New()
+	}
+
+	for _, bm := range bitmaps {
+		for j := n - 1; j > 0; j-- {
+			atLeast[j].Or(roaring.And(atLeast[j-1], bm))
+		}
+		atLeast[0].Or(bm)
+	}
+
+	rate := float64(atLeast[n-1].GetCardinality()) / (1 << 32)
+	l.rates.Store(&bitmapRates{version: version, n: n, rate: rate})
+	return rate
+}
+
+func (l *Loader) Close() error {
+	l.fileBitmapsM.Lock()
+	defer l.fileBitmapsM.Unlock()
+
+	l.fileBitmaps = make(map[string]*roaring.Bitmap)
+	l.version++
+	return nil
+}
+
 func hashToUint32(s string) uint32 {
 	return uint32(xxhash.Sum64String(s))
 }
@@ -0,0 +1,65 @@
+package cacheBitmap
+
+import (
+	"io"
+
+	"github.com/RoaringBitmap/roaring/v2"
+
+	"order-food-api/core/couponindex"
+)
+
+// WriteSnapshot writes the merged bitmap of every loaded file.
+func (l *Loader) WriteSnapshot(w io.Writer) error {
+	l.fileBitmapsM.Lock()
+	defer l.fileBitmapsM.Unlock()
+
+	sw := couponindex.NewSnapshotWriter(w)
+	sw.Uint64(uint64(l.codes.Load()))
+	loaded := l.tracker.Status().Files
+	sw.Len(len(loaded))
+	for _, f := range loaded {
+		bm, ok := l.fileBitmaps[f.File]
+		if !ok {
+			bm = roaring.New()
+		}
+		b, err := bm.ToBytes()
+		if err != nil {
+			return err
+		}
+		sw.String(f.File)
+		sw.Bytes(b)
+	}
+	return sw.Err()
+}
+
+func (l *Loader) ReadSnapshot(r io.Reader) error {
+	sr := couponindex.NewSnapshotReader(r)
+	codes := sr.Uint64()
+	n := sr.Len()
+
+	bitmaps := make(map[string]*roaring.Bitmap, n)
+	var files []string
+	for i := 0; i < n && sr.Err() == nil; i++ {
+		file, b := sr.String(), sr.Bytes()
+		if sr.Err() != nil {
+			break
+		}
+		bm := roaring.New()
+		if err := bm.UnmarshalBinary(b); err != nil {
+			return err
+		}
+		bitmaps[file] = bm
+		files = append(files, file)
+	}
+	if err := sr.Err(); err != nil {
+		return err
+	}
+
+	l.fileBitmapsM.Lock()
+	l.fileBitmaps = bitmaps
+	l.version++
+	l.fileBitmapsM.Unlock()
+	l.codes.Store(int64(codes))
+	l.tracker.Restored(files)
+	return nil
+}
@@ -0,0 +1,43 @@
+package cacheBloomFilter
+
+import (
+	"math"
+
+	"github.com/bits-and-blooms/bloom/v3"
+
+	"order-food-api/core/couponindex"
+)
+
+// fileRates caches the per-file false positive rates of a published table
+// set, since counting the set bits of every filter is not free.
+type fileRates struct {
+	tables *fileFilters
+	rates  []float64
+}
+
+// FalsePositiveRate estimates the rate from the bits actually set in each
+// filter rather than from the configured target rate, so over-full or
+// merged filters are reported as they are.
+func (l *Loader) FalsePositiveRate(n int) float64 {
+	tables := l.tables.Load()
+	cached := l.rates.Load()
+	if cached == nil || cached.tables != tables {
+		cached = &fileRates{tables: tables}
+		for _, filters := range *tables {
+			cached.rates = append(cached.rates, fileRate(filters))
+		}
+		l.rates.Store(cached)
+	}
+	return couponindex.AtLeastNRate(cached.rates, n)
+}
+
+// fileRate is the probability that at least one chunk filter of a file
+// matches a code it does not contain.
+func fileRate(filters []*bloom.BloomFilter) float64 {
+	miss := 1.0
+	for _, filter := range filters {
+		fill := float64(filter.BitSet().Count()) / float64(filter.Cap())
+		miss *= 1 - math.Pow(fill, float64(filter.K()))
+	}
+	return 1 - miss
+}
@@ -1,99 +1,111 @@
-package cacheMap
+package cacheBloomFilter
 
 import (
-	"bufio"
-	"compress/gzip"
 	"fmt"
-	"os"
+	"maps"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/bits-and-blooms/bloom/v3"
+
+	"order-food-api/core/couponindex"
 )
 
+const Name = "bloom"
+
 const (
 	chunkSize      = 5_000_000 // lines per chunk (adjust as needed)
 	workerCount    = 32        // concurrency level
 	bloomFalseRate = 0.0000001 // false positive rate per bloom filter
 )
 
+// fileFilters maps a file to its chunk bloom filters. A published value is
+// never modified; publishing a file stores a new copy.
+type fileFilters map[string][]*bloom.BloomFilter
+
 type Loader struct {
-	workerTables []map[string][]*bloom.BloomFilter // worker -> file -> list of chunk bloom filters
-	lineChan     chan fileChunk
-	wg           sync.WaitGroup
+	tables    atomic.Pointer[fileFilters]
+	rates     atomic.Pointer[fileRates]
+	publishMu sync.Mutex
+	lineChan  chan fileChunk
+	wg        sync.WaitGroup
+	publishWg sync.WaitGroup
+	codes     atomic.Int64
+	tracker   couponindex.Tracker
 }
 
 type fileChunk struct {
+	build *fileBuild
+	lines []string
+}
+
+// fileBuild collects the filters of one file until all its chunks are done.
+type fileBuild struct {
 	fileName string
-	lines    []string
+	pending  sync.WaitGroup
+	mu       sync.Mutex
+	filters  []*bloom.BloomFilter
 }
 
-func New() *Loader {
-	workerTables := make([]map[string][]*bloom.BloomFilter, workerCount)
-	for i := 0; i < workerCount; i++ {
-		workerTables[i] = make(map[string][]*bloom.BloomFilter)
-	}
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
+}
 
-	return &Loader{
-		workerTables: workerTables,
-		lineChan:     make(chan fileChunk, workerCount*2),
+func New() *Loader {
+	l := &Loader{
+		lineChan: make(chan fileChunk, workerCount*2),
 	}
+	l.tables.Store(&fileFilters{})
+	return l
 }
 
 func (l *Loader) LoadFiles(files []string) error {
+	l.tracker.Begin(files)
+
 	for i := 0; i < workerCount; i++ {
 		l.wg.Add(1)
-		go l.worker(l.workerTables[i])
+		go l.worker()
 	}
 
+	var err error
 	for _, file := range files {
-		if err := l.loadFile(file); err != nil {
-			return fmt.Errorf("error loading %s: %w", file, err)
+		if err = l.loadFile(file); err != nil {
+			err = fmt.Errorf("error loading %s: %w", file, err)
+			break
 		}
 	}
 
 	close(l.lineChan)
 	l.wg.Wait()
-	return nil
+	l.publishWg.Wait()
+	l.tracker.Finish(err)
+	return err
 }
 
+// loadFile queues the chunks of path and publishes the file once all of them
+// are indexed, while later files are still being read.
 func (l *Loader) loadFile(path string) error {
-	f, err := os.Open(path)
+	build := &fileBuild{fileName: path}
+	err := couponindex.ReadChunks(path, chunkSize, &l.tracker, func(lines []string) {
+		build.pending.Add(1)
+		l.lineChan <- fileChunk{build: build, lines: lines}
+	})
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	r, err := gzip.NewReader(f)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	var chunk []string
-	for scanner.Scan() {
-		chunk = append(chunk, scanner.Text())
-		if len(chunk) >= chunkSize {
-			copyChunk := make([]string, len(chunk))
-			copy(copyChunk, chunk)
-			l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-			chunk = chunk[:0]
-		}
-	}
-	if len(chunk) > 0 {
-		copyChunk := make([]string, len(chunk))
-		copy(copyChunk, chunk)
-		l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-	}
 
-	return scanner.Err()
+	l.publishWg.Add(1)
+	go func() {
+		defer l.publishWg.Done()
+		build.pending.Wait()
+		l.publish(build.fileName, build.filters)
+	}()
+	return nil
 }
 
-func (l *Loader) worker(localMap map[string][]*bloom.BloomFilter) {
+func (l *Loader) worker() {
 	defer l.wg.Done()
 
 	for job := range l.lineChan {
@@ -105,33 +117,62 @@ func (l *Loader) worker(localMap map[string][]*bloom.BloomFilter) {
 			}
 		}
 
-		localMap[job.fileName] = append(localMap[job.fileName], filter)
+		job.build.mu.Lock()
+		job.build.filters = append(job.build.filters, filter)
+		job.build.mu.Unlock()
+		job.build.pending.Done()
+		l.codes.Add(int64(len(job.lines)))
 
-		fmt.Printf("Loaded chunk for %s with %d codes\n", filepath.Base(job.fileName), len(job.lines))
+		fmt.Printf("Loaded chunk for %s with %d codes\n", filepath.Base(job.build.fileName), len(job.lines))
 	}
 }
 
-func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
-	seenFiles := make(map[string]struct{})
+func (l *Loader) publish(file string, filters []*bloom.BloomFilter) {
+	l.publishMu.Lock()
+	defer l.publishMu.Unlock()
 
-	for _, workerMap := range l.workerTables {
-		for file, filters := range workerMap {
-			if _, already := seenFiles[file]; already {
-				continue
-			}
-
-			for _, filter := range filters {
-				if filter.TestString(code) {
-					seenFiles[file] = struct{}{}
-					break
-				}
-			}
+	next := maps.Clone(*l.tables.Load())
+	next[file] = filters
+	l.tables.Store(&next)
+}
 
-			if len(seenFiles) >= n {
-				return true
+func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
+	found := 0
+	for _, filters := range *l.tables.Load() {
+		for _, filter := range filters {
+			if filter.TestString(code) {
+				found++
+				break
 			}
 		}
+		if found >= n {
+			return true
+		}
 	}
 
 	return false
 }
+
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	tables := *l.tables.Load()
+	structures := 0
+	for _, filters := range tables {
+		structures += len(filters)
+	}
+
+	return couponindex.Stats{
+		Backend:    Name,
+		Files:      len(tables),
+		Codes:      l.codes.Load(),
+		Structures: structures,
+	}
+}
+
+func (l *Loader) Close() error {
+	l.tables.Store(&fileFilters{})
+	return nil
+}
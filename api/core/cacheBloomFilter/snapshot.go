@@ -0,0 +1,54 @@
+package cacheBloomFilter
+
+import (
+	"io"
+
+	"github.com/bits-and-blooms/bloom/v3"
+
+	"order-food-api/core/couponindex"
+)
+
+// WriteSnapshot writes the chunk bloom filters of every loaded file.
+func (l *Loader) WriteSnapshot(w io.Writer) error {
+	tables := *l.tables.Load()
+
+	sw := couponindex.NewSnapshotWriter(w)
+	sw.Uint64(uint64(l.codes.Load()))
+	loaded := l.tracker.Status().Files
+	sw.Len(len(loaded))
+	for _, f := range loaded {
+		sw.String(f.File)
+		sw.Len(len(tables[f.File]))
+		for _, filter := range tables[f.File] {
+			sw.WriterTo(filter)
+		}
+	}
+	return sw.Err()
+}
+
+func (l *Loader) ReadSnapshot(r io.Reader) error {
+	sr := couponindex.NewSnapshotReader(r)
+	codes := sr.Uint64()
+	n := sr.Len()
+
+	tables := make(fileFilters, n)
+	var files []string
+	for i := 0; i < n && sr.Err() == nil; i++ {
+		file := sr.String()
+		count := sr.Len()
+		for j := 0; j < count && sr.Err() == nil; j++ {
+			filter := &bloom.BloomFilter{}
+			sr.ReaderFrom(filter)
+			tables[file] = append(tables[file], filter)
+		}
+		files = append(files, file)
+	}
+	if err := sr.Err(); err != nil {
+		return err
+	}
+
+	l.tables.Store(&tables)
+	l.codes.Store(int64(codes))
+	l.tracker.Restored(files)
+	return nil
+}
@@ -0,0 +1,227 @@
+package cacheExact
+
+import (
+	"container/heap"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"order-food-api/core/couponindex"
+	"order-food-api/core/couponkey"
+)
+
+const Name = "exact"
+
+const (
+	chunkSize   = 5_000_000
+	workerCount = 16
+)
+
+// Loader merges all coupon files into one sorted, deduplicated slice of
+// packed entries: the encoded code plus a bitmask of the files containing
+// it. A lookup is a single binary search and never yields a false positive.
+type Loader struct {
+	table   atomic.Pointer[table]
+	tracker couponindex.Tracker
+}
+
+type table struct {
+	files   []string
+	entries []uint64
+}
+
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
+}
+
+func New() *Loader {
+	l := &Loader{}
+	l.table.Store(&table{})
+	return l
+}
+
+func (l *Loader) LoadFiles(files []string) error {
+	l.tracker.Begin(files)
+
+	var err error
+	var perFile [][]uint64
+	if len(files) > couponkey.MaxFiles {
+		err = fmt.Errorf("exact index supports at most %d files, got %d", couponkey.MaxFiles, len(files))
+	}
+	for _, file := range files {
+		if err != nil {
+			break
+		}
+		var keys []uint64
+		if keys, err = l.loadFile(file); err != nil {
+			err = fmt.Errorf("error loading %s: %w", file, err)
+			break
+		}
+		perFile = append(perFile, keys)
+	}
+
+	if err == nil {
+		largest := 0
+		for _, keys := range perFile {
+			largest = max(largest, len(keys))
+		}
+		entries := make([]uint64, 0, largest)
+		mergeRuns(perFile, func(key uint64, mask uint8) {
+			entries = append(entries, couponkey.Pack(key, mask))
+		})
+		l.table.Store(&table{files: slices.Clone(files), entries: slices.Clip(entries)})
+		fmt.Printf("Merged %d files into %d distinct codes\n", len(files), len(entries))
+	}
+
+	l.tracker.Finish(err)
+	return err
+}
+
+// loadFile returns the sorted, deduplicated keys of every valid code in path.
+func (l *Loader) loadFile(path string) ([]uint64, error) {
+	var (
+		mu   sync.Mutex
+		runs [][]uint64
+		wg   sync.WaitGroup
+	)
+
+	lineChan := make(chan []string, workerCount*2)
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for lines := range lineChan {
+				run := encodeSorted(lines)
+				mu.Lock()
+				runs = append(runs, run)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := couponindex.ReadChunks(path, chunkSize, &l.tracker, func(lines []string) {
+		lineChan <- lines
+	})
+	close(lineChan)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []uint64
+	mergeRuns(runs, func(key uint64, _ uint8) {
+		keys = append(keys, key)
+	})
+	fmt.Printf("Indexed %s with %d distinct codes\n", filepath.Base(path), len(keys))
+	return slices.Clip(keys), nil
+}
+
+func encodeSorted(lines []string) []uint64 {
+	keys := make([]uint64, 0, len(lines))
+	for _, line := range lines {
+		if key, ok := couponkey.Encode(strings.TrimSpace(line)); ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
+	entry, ok := l.lookup(code)
+	return ok && couponkey.FileCount(entry) >= n
+}
+
+// FileSet returns the coupon files that contain code.
+func (l *Loader) FileSet(code string) []string {
+	entry, ok := l.lookup(code)
+	if !ok {
+		return nil
+	}
+
+	t := l.table.Load()
+	_, mask := couponkey.Unpack(entry)
+	var files []string
+	for i, file := range t.files {
+		if mask&(1<<i) != 0 {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (l *Loader) lookup(code string) (uint64, bool) {
+	key, ok := couponkey.Encode(code)
+	if !ok {
+		return 0, false
+	}
+	return couponkey.Find(l.table.Load().entries, key)
+}
+
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	t := l.table.Load()
+	return couponindex.Stats{
+		Backend:    Name,
+		Files:      len(t.files),
+		Codes:      int64(len(t.entries)),
+		Structures: 1,
+	}
+}
+
+func (l *Loader) Close() error {
+	l.table.Store(&table{})
+	return nil
+}
+
+// mergeRuns walks sorted runs in ascending order and calls emit once per
+// distinct key with the bitmask of runs that contain it.
+func mergeRuns(runs [][]uint64, emit func(key uint64, mask uint8)) {
+	h := make(runHeap, 0, len(runs))
+	for i, run := range runs {
+		if len(run) > 0 {
+			h = append(h, runCursor{run: run, src: i})
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		key := h[0].run[h[0].pos]
+		var mask uint8
+		for h.Len() > 0 && h[0].run[h[0].pos] == key {
+			mask |= 1 << (h[0].src % 8)
+			h[0].pos++
+			if h[0].pos == len(h[0].run) {
+				heap.Pop(&h)
+			} else {
+				heap.Fix(&h, 0)
+			}
+		}
+		emit(key, mask)
+	}
+}
+
+type runCursor struct {
+	run []uint64
+	pos int
+	src int
+}
+
+type runHeap []runCursor
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return h[i].run[h[i].pos] < h[j].run[h[j].pos] }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(runCursor)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,37 @@
+package cacheExact
+
+import (
+	"io"
+
+	"order-food-api/core/couponindex"
+)
+
+// WriteSnapshot writes the file names and the packed entries.
+func (l *Loader) WriteSnapshot(w io.Writer) error {
+	t := l.table.Load()
+
+	sw := couponindex.NewSnapshotWriter(w)
+	sw.Len(len(t.files))
+	for _, file := range t.files {
+		sw.String(file)
+	}
+	sw.Uint64s(t.entries)
+	return sw.Err()
+}
+
+func (l *Loader) ReadSnapshot(r io.Reader) error {
+	sr := couponindex.NewSnapshotReader(r)
+	n := sr.Len()
+	var files []string
+	for i := 0; i < n && sr.Err() == nil; i++ {
+		files = append(files, sr.String())
+	}
+	entries := sr.Uint64s()
+	if err := sr.Err(); err != nil {
+		return err
+	}
+
+	l.table.Store(&table{files: files, entries: entries})
+	l.tracker.Restored(files)
+	return nil
+}
@@ -1,124 +1,136 @@
 package cacheMPH
 
 import (
-	"bufio"
-	"compress/gzip"
 	"fmt"
+	"order-food-api/core/couponindex"
+	"order-food-api/core/couponkey"
 	"order-food-api/core/mph"
-	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 )
 
+const Name = "mph"
+
 const (
 	chunkSize   = 5_000_000
 	workerCount = 16
 )
 
 type Loader struct {
-	mu         sync.Mutex
-	fileTables map[string][]*mph.Table // file -> tables
+	mu         sync.RWMutex
+	fileTables map[string]*mph.Table // file -> consolidated table
 	wg         sync.WaitGroup
+	mergeWg    sync.WaitGroup
 	lineChan   chan fileChunk
+	codes      atomic.Int64
+	tracker    couponindex.Tracker
 }
 
 type fileChunk struct {
+	build *fileBuild
+	lines []string
+}
+
+// fileBuild collects the encoded chunks of one file until all of them are
+// done, so the file's table is built once from all its keys.
+type fileBuild struct {
 	fileName string
-	lines    []string
+	pending  sync.WaitGroup
+	mu       sync.Mutex
+	chunks   [][]uint64
+}
+
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
 }
 
 func New() *Loader {
 	return &Loader{
-		fileTables: make(map[string][]*mph.Table),
+		fileTables: make(map[string]*mph.Table),
 		lineChan:   make(chan fileChunk, workerCount*2),
 	}
 }
 
 func (l *Loader) LoadFiles(files []string) error {
+	l.tracker.Begin(files)
+
 	for i := 0; i < workerCount; i++ {
 		l.wg.Add(1)
 		go l.worker()
 	}
 
+	var err error
 	for _, file := range files {
-		if err := l.loadFile(file); err != nil {
-			return fmt.Errorf("error loading %s: %w", file, err)
+		if err = l.loadFile(file); err != nil {
+			err = fmt.Errorf("error loading %s: %w", file, err)
+			break
 		}
 	}
 
 	close(l.lineChan)
 	l.wg.Wait()
-	return nil
+	l.mergeWg.Wait()
+	l.tracker.Finish(err)
+	return err
 }
 
+// loadFile queues the chunks of path and, once all of them are encoded,
+// consolidates them into one table for the file while later files are
+// still being read.
 func (l *Loader) loadFile(path string) error {
-	f, err := os.Open(path)
+	build := &fileBuild{fileName: path}
+	err := couponindex.ReadChunks(path, chunkSize, &l.tracker, func(lines []string) {
+		build.pending.Add(1)
+		l.lineChan <- fileChunk{build: build, lines: lines}
+	})
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	r, err := gzip.NewReader(f)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	var chunk []string
-	for scanner.Scan() {
-		chunk = append(chunk, scanner.Text())
-		if len(chunk) >= chunkSize {
-			copyChunk := make([]string, len(chunk))
-			copy(copyChunk, chunk)
-			l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-			chunk = chunk[:0]
-		}
-	}
-	if len(chunk) > 0 {
-		copyChunk := make([]string, len(chunk))
-		copy(copyChunk, chunk)
-		l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-	}
-	return scanner.Err()
+	l.mergeWg.Add(1)
+	go func() {
+		defer l.mergeWg.Done()
+		build.pending.Wait()
+		l.consolidate(build)
+	}()
+	return nil
 }
 
 func (l *Loader) worker() {
 	defer l.wg.Done()
 	for job := range l.lineChan {
-		table := mph.Build(job.lines)
+		keys := couponkey.EncodeAll(job.lines)
 
-		l.mu.Lock()
-		l.fileTables[job.fileName] = append(l.fileTables[job.fileName], table)
-		l.mu.Unlock()
+		job.build.mu.Lock()
+		job.build.chunks = append(job.build.chunks, keys)
+		job.build.mu.Unlock()
+		job.build.pending.Done()
+		l.codes.Add(int64(len(job.lines)))
 
-		fmt.Printf("Built table for %s with %d entries %d extras\n",
-			filepath.Base(job.fileName), len(job.lines), len(table.Extra))
+		fmt.Printf("Encoded chunk for %s with %d keys\n", filepath.Base(job.build.fileName), len(keys))
 	}
 }
 
-func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
-	count := 0
+func (l *Loader) consolidate(build *fileBuild) {
+	table := mph.BuildSorted(couponkey.MergeSorted(build.chunks...))
 
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.fileTables[build.fileName] = table
+	l.mu.Unlock()
+
+	fmt.Printf("Built table for %s from %d chunks with %d entries %d extras\n",
+		filepath.Base(build.fileName), len(build.chunks), table.Len(), len(table.Extra))
+}
 
-	for _, tables := range l.fileTables {
-		found := false
+func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
+	count := 0
 
-		for _, t := range tables {
-			if _, ok := t.Lookup(code); ok {
-				found = true
-				break
-			}
-			if found {
-				break
-			}
-		}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 
-		if found {
+	for _, t := range l.fileTables {
+		if _, ok := t.Lookup(code); ok {
 			count++
 			if count >= n {
 				return true
@@ -128,3 +140,27 @@ func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
 
 	return false
 }
+
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return couponindex.Stats{
+		Backend:    Name,
+		Files:      len(l.fileTables),
+		Codes:      l.codes.Load(),
+		Structures: len(l.fileTables),
+	}
+}
+
+func (l *Loader) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fileTables = make(map[string]*mph.Table)
+	return nil
+}
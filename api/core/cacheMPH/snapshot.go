@@ -0,0 +1,54 @@
+package cacheMPH
+
+import (
+	"io"
+
+	"order-food-api/core/couponindex"
+	"order-food-api/core/mph"
+)
+
+// WriteSnapshot writes the consolidated table of every loaded file.
+func (l *Loader) WriteSnapshot(w io.Writer) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	sw := couponindex.NewSnapshotWriter(w)
+	sw.Uint64(uint64(l.codes.Load()))
+	loaded := l.tracker.Status().Files
+	sw.Len(len(loaded))
+	for _, f := range loaded {
+		t, ok := l.fileTables[f.File]
+		if !ok {
+			t = &mph.Table{}
+		}
+		sw.String(f.File)
+		sw.WriterTo(t)
+	}
+	return sw.Err()
+}
+
+func (l *Loader) ReadSnapshot(r io.Reader) error {
+	sr := couponindex.NewSnapshotReader(r)
+	codes := sr.Uint64()
+	n := sr.Len()
+
+	fileTables := make(map[string]*mph.Table, n)
+	var files []string
+	for i := 0; i < n && sr.Err() == nil; i++ {
+		file := sr.String()
+		t := &mph.Table{}
+		sr.ReaderFrom(t)
+		fileTables[file] = t
+		files = append(files, file)
+	}
+	if err := sr.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.fileTables = fileTables
+	l.mu.Unlock()
+	l.codes.Store(int64(codes))
+	l.tracker.Restored(files)
+	return nil
+}
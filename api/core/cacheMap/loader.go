@@ -1,15 +1,18 @@
 package cacheMap
 
 import (
-	"bufio"
-	"compress/gzip"
 	"fmt"
-	"os"
+	"maps"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+
+	"order-food-api/core/couponindex"
 )
 
+const Name = "map"
+
 const (
 	chunkSize   = 5_000_000
 	workerCount = 32
@@ -23,90 +26,97 @@ func toCodeKey(s string) CodeKey {
 	return key
 }
 
+type codeSet map[CodeKey]struct{}
+
+// fileCodes maps a file to its code set. A published value is never
+// modified; publishing a file stores a new copy.
+type fileCodes map[string]codeSet
+
 type Loader struct {
-	workerTables []map[string]map[CodeKey]struct{}
-	lineChan     chan fileChunk
-	wg           sync.WaitGroup
+	tables    atomic.Pointer[fileCodes]
+	publishMu sync.Mutex
+	lineChan  chan fileChunk
+	wg        sync.WaitGroup
+	publishWg sync.WaitGroup
+	codes     atomic.Int64
+	tracker   couponindex.Tracker
 }
 
 type fileChunk struct {
+	build *fileBuild
+	lines []string
+}
+
+// fileBuild collects the chunk sets of one file until all its chunks are done.
+type fileBuild struct {
 	fileName string
-	lines    []string
+	pending  sync.WaitGroup
+	mu       sync.Mutex
+	sets     []codeSet
 }
 
-func New() *Loader {
-	workerTables := make([]map[string]map[CodeKey]struct{}, workerCount)
-	for i := 0; i < workerCount; i++ {
-		workerTables[i] = make(map[string]map[CodeKey]struct{})
-	}
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
+}
 
-	return &Loader{
-		workerTables: workerTables,
-		lineChan:     make(chan fileChunk, workerCount*2),
+func New() *Loader {
+	l := &Loader{
+		lineChan: make(chan fileChunk, workerCount*2),
 	}
+	l.tables.Store(&fileCodes{})
+	return l
 }
 
 func (l *Loader) LoadFiles(files []string) error {
+	l.tracker.Begin(files)
+
 	for i := 0; i < workerCount; i++ {
 		l.wg.Add(1)
-		go l.worker(l.workerTables[i])
+		go l.worker()
 	}
 
+	var err error
 	for _, file := range files {
-		if err := l.loadFile(file); err != nil {
-			return fmt.Errorf("error loading %s: %w", file, err)
+		if err = l.loadFile(file); err != nil {
+			err = fmt.Errorf("error loading %s: %w", file, err)
+			break
 		}
 	}
 
 	close(l.lineChan)
 	l.wg.Wait()
-	return nil
+	l.publishWg.Wait()
+	l.tracker.Finish(err)
+	return err
 }
 
+// loadFile queues the chunks of path and, once all of them are indexed,
+// merges them into one set and publishes it while later files are still
+// being read.
 func (l *Loader) loadFile(path string) error {
-	f, err := os.Open(path)
+	build := &fileBuild{fileName: path}
+	err := couponindex.ReadChunks(path, chunkSize, &l.tracker, func(lines []string) {
+		build.pending.Add(1)
+		l.lineChan <- fileChunk{build: build, lines: lines}
+	})
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	r, err := gzip.NewReader(f)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	var chunk []string
-	for scanner.Scan() {
-		chunk = append(chunk, scanner.Text())
-		if len(chunk) >= chunkSize {
-			copyChunk := make([]string, len(chunk))
-			copy(copyChunk, chunk)
-			l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-			chunk = chunk[:0]
-		}
-	}
-	if len(chunk) > 0 {
-		copyChunk := make([]string, len(chunk))
-		copy(copyChunk, chunk)
-		l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-	}
-	return scanner.Err()
+	l.publishWg.Add(1)
+	go func() {
+		defer l.publishWg.Done()
+		build.pending.Wait()
+		l.publish(build.fileName, mergeSets(build.sets))
+	}()
+	return nil
 }
 
-func (l *Loader) worker(localMap map[string]map[CodeKey]struct{}) {
+func (l *Loader) worker() {
 	defer l.wg.Done()
 
 	for job := range l.lineChan {
-		codes, ok := localMap[job.fileName]
-		if !ok {
-			codes = make(map[CodeKey]struct{})
-			localMap[job.fileName] = codes
-		}
-
+		codes := make(codeSet, len(job.lines))
 		for _, line := range job.lines {
 			code := strings.TrimSpace(line)
 			if code != "" && len(code) <= 10 {
@@ -114,31 +124,81 @@ func (l *Loader) worker(localMap map[string]map[CodeKey]struct{}) {
 			}
 		}
 
-		fmt.Printf("Loaded chunk for %s with %d codes\n", filepath.Base(job.fileName), len(job.lines))
+		job.build.mu.Lock()
+		job.build.sets = append(job.build.sets, codes)
+		job.build.mu.Unlock()
+		job.build.pending.Done()
+		l.codes.Add(int64(len(job.lines)))
+
+		fmt.Printf("Loaded chunk for %s with %d codes\n", filepath.Base(job.build.fileName), len(job.lines))
 	}
 }
 
+// mergeSets folds all chunk sets into the largest one.
+func mergeSets(sets []codeSet) codeSet {
+	if len(sets) == 0 {
+		return codeSet{}
+	}
+
+	largest := 0
+	for i, set := range sets {
+		if len(set) > len(sets[largest]) {
+			largest = i
+		}
+	}
+
+	merged := sets[largest]
+	for i, set := range sets {
+		if i != largest {
+			maps.Copy(merged, set)
+		}
+	}
+	return merged
+}
+
+func (l *Loader) publish(file string, codes codeSet) {
+	l.publishMu.Lock()
+	defer l.publishMu.Unlock()
+
+	next := maps.Clone(*l.tables.Load())
+	next[file] = codes
+	l.tables.Store(&next)
+}
+
 func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
 	if code == "" || len(code) > 10 {
 		return false
 	}
 	key := toCodeKey(code)
 
-	seenFiles := make(map[string]struct{})
-
-	for _, workerMap := range l.workerTables {
-		for file, codes := range workerMap {
-			if _, alreadyCounted := seenFiles[file]; alreadyCounted {
-				continue
-			}
-			if _, ok := codes[key]; ok {
-				seenFiles[file] = struct{}{}
-				if len(seenFiles) >= n {
-					return true
-				}
+	found := 0
+	for _, codes := range *l.tables.Load() {
+		if _, ok := codes[key]; ok {
+			found++
+			if found >= n {
+				return true
 			}
 		}
 	}
 
 	return false
 }
+
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	tables := *l.tables.Load()
+	return couponindex.Stats{
+		Backend:    Name,
+		Files:      len(tables),
+		Codes:      l.codes.Load(),
+		Structures: len(tables),
+	}
+}
+
+func (l *Loader) Close() error {
+	l.tables.Store(&fileCodes{})
+	return nil
+}
@@ -0,0 +1,107 @@
+package cachePrepared
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"order-food-api/core/couponkey"
+)
+
+// Disk answers lookups by binary searching the artifact on disk instead of
+// loading it, trading a few reads per lookup for no memory. It serves as an
+// exact couponindex.Verifier for probabilistic backends.
+type Disk struct {
+	f      *os.File
+	header Header
+	offset int64
+	count  int64
+}
+
+// ErrStale reports a prepared file older than the coupon files it should
+// reflect; it would reject every code added to them since.
+var ErrStale = errors.New("prepared coupon file is older than the coupon files")
+
+// OpenFresh opens path like Open, but fails with ErrStale if any of sources
+// was modified after it. Regenerate the file with couponprep to fix it.
+func OpenFresh(path string, sources []string) (*Disk, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range sources {
+		srcInfo, err := os.Stat(src)
+		if err != nil {
+			return nil, err
+		}
+		if srcInfo.ModTime().After(info.ModTime()) {
+			return nil, fmt.Errorf("%w: %s changed after %s", ErrStale, src, path)
+		}
+	}
+	return Open(path)
+}
+
+func Open(path string) (*Disk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := readHeader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	body := info.Size() - h.size()
+	if body < 0 || body%entrySize != 0 {
+		f.Close()
+		return nil, errors.New("truncated prepared coupon file")
+	}
+	return &Disk{f: f, header: h, offset: h.size(), count: body / entrySize}, nil
+}
+
+// Verify reports whether code is found in at least n files. Codes found in
+// fewer than Header.MinFiles files are not in the artifact, so for such n it
+// can only confirm codes that also reach MinFiles.
+func (d *Disk) Verify(code string, n int) (bool, error) {
+	key, ok := couponkey.Encode(code)
+	if !ok {
+		return false, nil
+	}
+
+	var buf [entrySize]byte
+	lo, hi := int64(0), d.count
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if _, err := d.f.ReadAt(buf[:], d.offset+mid*entrySize); err != nil {
+			return false, err
+		}
+		entry := binary.LittleEndian.Uint64(buf[:])
+		k, _ := couponkey.Unpack(entry)
+		switch {
+		case k < key:
+			lo = mid + 1
+		case k > key:
+			hi = mid
+		default:
+			return couponkey.FileCount(entry) >= n, nil
+		}
+	}
+	return false, nil
+}
+
+func (d *Disk) Header() Header {
+	return d.header
+}
+
+func (d *Disk) Close() error {
+	return d.f.Close()
+}
@@ -0,0 +1,57 @@
+package cachePrepared
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"order-food-api/core/couponkey"
+)
+
+func TestOpenFreshRejectsStaleFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "couponbase1.gz")
+	prepared := filepath.Join(dir, "coupons.prep")
+	if err := os.WriteFile(source, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(prepared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(f, Header{MinFiles: 2, Files: []string{source}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := couponkey.Encode("ABCDEFGH")
+	if err := w.Add(couponkey.Pack(key, 0b11)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	now := time.Now()
+	if err := os.Chtimes(source, now, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	d, err := OpenFresh(prepared, []string{source})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.Verify("ABCDEFGH", 2); !ok || err != nil {
+		t.Fatalf("Verify() = %v, %v", ok, err)
+	}
+	d.Close()
+
+	if err := os.Chtimes(source, now, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFresh(prepared, []string{source}); !errors.Is(err, ErrStale) {
+		t.Fatalf("OpenFresh() = %v, want ErrStale", err)
+	}
+}
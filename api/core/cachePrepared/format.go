@@ -0,0 +1,124 @@
+package cachePrepared
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The prepared artifact is a small header followed by sorted packed entries
+// (see couponkey.Pack) up to EOF, 8 bytes each in little endian.
+//
+//	magic    [8]byte  "CPNPREP1"
+//	minFiles uint32   entries were kept when found in at least this many files
+//	files    uint32   number of source files, then per file a uint32 length and name
+const magic = "CPNPREP1"
+
+const entrySize = 8
+
+var errNotPrepared = errors.New("not a prepared coupon file")
+
+type Header struct {
+	MinFiles int
+	Files    []string
+}
+
+// size is the number of bytes the encoded header takes.
+func (h Header) size() int64 {
+	n := int64(len(magic) + 4 + 4)
+	for _, f := range h.Files {
+		n += 4 + int64(len(f))
+	}
+	return n
+}
+
+// Writer streams a prepared artifact. Entries must be added in ascending order.
+type Writer struct {
+	w     *bufio.Writer
+	buf   [entrySize]byte
+	last  uint64
+	count int64
+}
+
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	bw := bufio.NewWriterSize(w, 1<<20)
+	if _, err := bw.WriteString(magic); err != nil {
+		return nil, err
+	}
+	for _, v := range []uint32{uint32(h.MinFiles), uint32(len(h.Files))} {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range h.Files {
+		if err := binary.Write(bw, binary.LittleEndian, uint32(len(f))); err != nil {
+			return nil, err
+		}
+		if _, err := bw.WriteString(f); err != nil {
+			return nil, err
+		}
+	}
+	return &Writer{w: bw}, nil
+}
+
+func (w *Writer) Add(entry uint64) error {
+	if w.count > 0 && entry <= w.last {
+		return fmt.Errorf("entry %d added out of order", entry)
+	}
+	w.last = entry
+	w.count++
+	binary.LittleEndian.PutUint64(w.buf[:], entry)
+	_, err := w.w.Write(w.buf[:])
+	return err
+}
+
+// Count returns the number of entries written so far.
+func (w *Writer) Count() int64 {
+	return w.count
+}
+
+// Flush writes any buffered entries to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func readHeader(r io.Reader) (Header, error) {
+	var h Header
+	buf := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return h, err
+	}
+	if string(buf) != magic {
+		return h, errNotPrepared
+	}
+
+	var minFiles, files uint32
+	if err := binary.Read(r, binary.LittleEndian, &minFiles); err != nil {
+		return h, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &files); err != nil {
+		return h, err
+	}
+	if files > 64 {
+		return h, errNotPrepared
+	}
+
+	h.MinFiles = int(minFiles)
+	for i := uint32(0); i < files; i++ {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return h, err
+		}
+		if n > 4096 {
+			return h, errNotPrepared
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return h, err
+		}
+		h.Files = append(h.Files, string(name))
+	}
+	return h, nil
+}
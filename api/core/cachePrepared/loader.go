@@ -0,0 +1,124 @@
+package cachePrepared
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"order-food-api/core/couponindex"
+	"order-food-api/core/couponkey"
+)
+
+const Name = "prepared"
+
+// Loader serves lookups from an artifact written by cmd/couponprep. Only
+// codes found in at least Header.MinFiles source files are in the artifact,
+// so AppearsInAtLeastN is exact for n >= MinFiles and reports false below it.
+type Loader struct {
+	table   atomic.Pointer[table]
+	tracker couponindex.Tracker
+}
+
+type table struct {
+	header  Header
+	entries []uint64
+}
+
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
+}
+
+func New() *Loader {
+	l := &Loader{}
+	l.table.Store(&table{})
+	return l
+}
+
+// LoadFiles reads the prepared artifact, which must be the only file given.
+func (l *Loader) LoadFiles(files []string) error {
+	l.tracker.Begin(files)
+
+	var err error
+	var t *table
+	if len(files) != 1 {
+		err = fmt.Errorf("prepared index expects exactly one artifact, got %d files", len(files))
+	} else if t, err = l.loadFile(files[0]); err != nil {
+		err = fmt.Errorf("error loading %s: %w", files[0], err)
+	}
+
+	if err == nil {
+		l.table.Store(t)
+		fmt.Printf("Loaded %s with %d codes found in at least %d files\n",
+			filepath.Base(files[0]), len(t.entries), t.header.MinFiles)
+	}
+	l.tracker.Finish(err)
+	return err
+}
+
+func (l *Loader) loadFile(path string) (t *table, err error) {
+	defer func() {
+		l.tracker.EndFile(path, err)
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	l.tracker.BeginFile(path, info.Size())
+
+	r := bufio.NewReaderSize(f, 1<<20)
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body := info.Size() - h.size()
+	if body < 0 || body%entrySize != 0 {
+		return nil, errors.New("truncated prepared coupon file")
+	}
+	entries := make([]uint64, body/entrySize)
+	if err := binary.Read(r, binary.LittleEndian, entries); err != nil {
+		return nil, err
+	}
+	l.tracker.Progress(path, int64(len(entries)), info.Size())
+
+	return &table{header: h, entries: entries}, nil
+}
+
+func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
+	key, ok := couponkey.Encode(code)
+	if !ok {
+		return false
+	}
+	entry, ok := couponkey.Find(l.table.Load().entries, key)
+	return ok && couponkey.FileCount(entry) >= n
+}
+
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	t := l.table.Load()
+	return couponindex.Stats{
+		Backend:    Name,
+		Files:      len(t.header.Files),
+		Codes:      int64(len(t.entries)),
+		Structures: 1,
+	}
+}
+
+func (l *Loader) Close() error {
+	l.table.Store(&table{})
+	return nil
+}
@@ -1,15 +1,16 @@
 package cacheSlicePersist
 
 import (
-	"bufio"
-	"compress/gzip"
 	"fmt"
+	"order-food-api/core/couponindex"
 	shardslice "order-food-api/core/shardslicePersist"
-	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 )
 
+const Name = "slicepersist"
+
 const (
 	chunkSize   = 5_000_000
 	workerCount = 16
@@ -20,6 +21,8 @@ type Loader struct {
 	fileTables map[string][]*shardslice.Table // file -> tables
 	wg         sync.WaitGroup
 	lineChan   chan fileChunk
+	codes      atomic.Int64
+	tracker    couponindex.Tracker
 }
 
 type fileChunk struct {
@@ -27,6 +30,10 @@ type fileChunk struct {
 	lines    []string
 }
 
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
+}
+
 func New() *Loader {
 	return &Loader{
 		fileTables: make(map[string][]*shardslice.Table),
@@ -35,54 +42,31 @@ func New() *Loader {
 }
 
 func (l *Loader) LoadFiles(files []string) error {
+	l.tracker.Begin(files)
+
 	for i := 0; i < workerCount; i++ {
 		l.wg.Add(1)
 		go l.worker()
 	}
 
+	var err error
 	for _, file := range files {
-		if err := l.loadFile(file); err != nil {
-			return fmt.Errorf("error loading %s: %w", file, err)
+		if err = l.loadFile(file); err != nil {
+			err = fmt.Errorf("error loading %s: %w", file, err)
+			break
 		}
 	}
 
 	close(l.lineChan)
 	l.wg.Wait()
-	return nil
+	l.tracker.Finish(err)
+	return err
 }
 
 func (l *Loader) loadFile(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	r, err := gzip.NewReader(f)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	var chunk []string
-	for scanner.Scan() {
-		chunk = append(chunk, scanner.Text())
-		if len(chunk) >= chunkSize {
-			copyChunk := make([]string, len(chunk))
-			copy(copyChunk, chunk)
-			l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-			chunk = chunk[:0]
-		}
-	}
-	if len(chunk) > 0 {
-		copyChunk := make([]string, len(chunk))
-		copy(copyChunk, chunk)
-		l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-	}
-	return scanner.Err()
+	return couponindex.ReadChunks(path, chunkSize, &l.tracker, func(lines []string) {
+		l.lineChan <- fileChunk{fileName: path, lines: lines}
+	})
 }
 
 func (l *Loader) worker() {
@@ -93,6 +77,7 @@ func (l *Loader) worker() {
 		l.mu.Lock()
 		l.fileTables[job.fileName] = append(l.fileTables[job.fileName], table)
 		l.mu.Unlock()
+		l.codes.Add(int64(len(job.lines)))
 
 		fmt.Printf("Built table for %s with %d entries %d extras\n",
 			filepath.Base(job.fileName), len(job.lines), len(table.Extra))
@@ -128,3 +113,32 @@ func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
 
 	return false
 }
+
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	structures := 0
+	for _, tables := range l.fileTables {
+		structures += len(tables)
+	}
+
+	return couponindex.Stats{
+		Backend:    Name,
+		Files:      len(l.fileTables),
+		Codes:      l.codes.Load(),
+		Structures: structures,
+	}
+}
+
+func (l *Loader) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fileTables = make(map[string][]*shardslice.Table)
+	return nil
+}
@@ -1,88 +1,98 @@
 package cacheTrie
 
 import (
-	"bufio"
-	"compress/gzip"
 	"fmt"
+	"order-food-api/core/couponindex"
 	"order-food-api/core/trie"
-	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 )
 
+const Name = "trie"
+
 const (
 	chunkSize   = 500_000
 	workerCount = 16
 )
 
 type Loader struct {
-	mu         sync.Mutex
-	fileTables map[string][]*trie.Trie // file -> tables
+	mu         sync.RWMutex
+	fileTables map[string]*trie.Trie // file -> consolidated table
 	wg         sync.WaitGroup
+	mergeWg    sync.WaitGroup
 	lineChan   chan fileChunk
+	codes      atomic.Int64
+	tracker    couponindex.Tracker
 }
 
 type fileChunk struct {
+	build *fileBuild
+	lines []string
+}
+
+// fileBuild collects the chunk tables of one file until all its chunks are done.
+type fileBuild struct {
 	fileName string
-	lines    []string
+	pending  sync.WaitGroup
+	mu       sync.Mutex
+	tables   []*trie.Trie
+}
+
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
 }
 
 func New() *Loader {
 	return &Loader{
-		fileTables: make(map[string][]*trie.Trie),
+		fileTables: make(map[string]*trie.Trie),
 		lineChan:   make(chan fileChunk, workerCount*2),
 	}
 }
 
 func (l *Loader) LoadFiles(files []string) error {
+	l.tracker.Begin(files)
+
 	for i := 0; i < workerCount; i++ {
 		l.wg.Add(1)
 		go l.worker()
 	}
 
+	var err error
 	for _, file := range files {
-		if err := l.loadFile(file); err != nil {
-			return fmt.Errorf("error loading %s: %w", file, err)
+		if err = l.loadFile(file); err != nil {
+			err = fmt.Errorf("error loading %s: %w", file, err)
+			break
 		}
 	}
 
 	close(l.lineChan)
 	l.wg.Wait()
-	return nil
+	l.mergeWg.Wait()
+	l.tracker.Finish(err)
+	return err
 }
 
+// loadFile queues the chunks of path and, once all of them are built,
+// consolidates them into one table for the file while later files are
+// still being read.
 func (l *Loader) loadFile(path string) error {
-	f, err := os.Open(path)
+	build := &fileBuild{fileName: path}
+	err := couponindex.ReadChunks(path, chunkSize, &l.tracker, func(lines []string) {
+		build.pending.Add(1)
+		l.lineChan <- fileChunk{build: build, lines: lines}
+	})
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	r, err := gzip.NewReader(f)
-	if err != nil {
-		return err
-	}
-	defer r.Close()
-
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	var chunk []string
-	for scanner.Scan() {
-		chunk = append(chunk, scanner.Text())
-		if len(chunk) >= chunkSize {
-			copyChunk := make([]string, len(chunk))
-			copy(copyChunk, chunk)
-			l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-			chunk = chunk[:0]
-		}
-	}
-	if len(chunk) > 0 {
-		copyChunk := make([]string, len(chunk))
-		copy(copyChunk, chunk)
-		l.lineChan <- fileChunk{fileName: path, lines: copyChunk}
-	}
-	return scanner.Err()
+	l.mergeWg.Add(1)
+	go func() {
+		defer l.mergeWg.Done()
+		build.pending.Wait()
+		l.consolidate(build)
+	}()
+	return nil
 }
 
 func (l *Loader) worker() {
@@ -92,35 +102,41 @@ func (l *Loader) worker() {
 		for _, line := range job.lines {
 			table.Insert(line)
 		}
-		l.mu.Lock()
-		l.fileTables[job.fileName] = append(l.fileTables[job.fileName], table)
-		l.mu.Unlock()
+
+		job.build.mu.Lock()
+		job.build.tables = append(job.build.tables, table)
+		job.build.mu.Unlock()
+		job.build.pending.Done()
+		l.codes.Add(int64(len(job.lines)))
 
 		fmt.Printf("Built table for %s with %d entries\n",
-			filepath.Base(job.fileName), len(job.lines))
+			filepath.Base(job.build.fileName), len(job.lines))
 	}
 }
 
-func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
-	count := 0
+func (l *Loader) consolidate(build *fileBuild) {
+	// Merging grafts the other chunk tries onto the first one, so no code
+	// is inserted twice.
+	table := trie.NewTrie()
+	if len(build.tables) > 0 {
+		table = build.tables[0].Merge(build.tables[1:]...)
+	}
 
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.fileTables[build.fileName] = table
+	l.mu.Unlock()
 
-	for _, tables := range l.fileTables {
-		found := false
+	fmt.Printf("Consolidated %d tables for %s\n", len(build.tables), filepath.Base(build.fileName))
+}
 
-		for _, t := range tables {
-			if ok := t.Search(code); ok {
-				found = true
-				break
-			}
-			if found {
-				break
-			}
-		}
+func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
+	count := 0
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 
-		if found {
+	for _, t := range l.fileTables {
+		if t.Search(code) {
 			count++
 			if count >= n {
 				return true
@@ -130,3 +146,27 @@ func (l *Loader) AppearsInAtLeastN(code string, n int) bool {
 
 	return false
 }
+
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return couponindex.Stats{
+		Backend:    Name,
+		Files:      len(l.fileTables),
+		Codes:      l.codes.Load(),
+		Structures: len(l.fileTables),
+	}
+}
+
+func (l *Loader) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fileTables = make(map[string]*trie.Trie)
+	return nil
+}
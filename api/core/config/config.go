@@ -2,12 +2,16 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
 
 type AppConfig struct {
 	Port string
+	// TrustedProxies are the proxies whose X-Forwarded-For header gives the
+	// client IP. Empty trusts none, using the address of the connection.
+	TrustedProxies []string `delim:","`
 }
 
 type DBConfig struct {
@@ -22,10 +26,45 @@ type AuthConfig struct {
 	ApiKey string
 }
 
+type CouponConfig struct {
+	Backend       string
+	Files         []string `delim:","`
+	SnapshotDir   string
+	WatchInterval time.Duration
+	VerifyFile    string
+	Case          string
+	// CheckPerMinute and CheckBurst rate limit the coupon check endpoints
+	// per client IP.
+	CheckPerMinute float64
+	CheckBurst     int
+}
+
+type PricingConfig struct {
+	DefaultDiscount    string
+	HappyHours         string
+	HappyHoursDiscount string
+	FiftyOffDiscount   string
+	Timezone           string
+}
+
+type OrderConfig struct {
+	MaxQuantity    int
+	IdempotencyTTL time.Duration
+}
+
+type ProductConfig struct {
+	// Categories are the categories a product may have; empty allows any.
+	Categories []string `delim:","`
+}
+
 type Config struct {
 	App      AppConfig
 	Database DBConfig
 	Auth     AuthConfig
+	Coupon   CouponConfig
+	Pricing  PricingConfig
+	Order    OrderConfig
+	Product  ProductConfig
 }
 
 var Cfg *Config
@@ -35,7 +74,30 @@ func LoadConfig(path string) *Config {
 		return Cfg
 	}
 
-	cfg := new(Config)
+	cfg := &Config{
+		Coupon: CouponConfig{
+			Backend: "bloom",
+			Files:   []string{"./files/couponbase1.gz", "./files/couponbase2.gz", "./files/couponbase3.gz"},
+			Case:    "upper",
+
+			CheckPerMinute: 30,
+			CheckBurst:     10,
+		},
+		Pricing: PricingConfig{
+			DefaultDiscount:    "10%",
+			HappyHours:         "16:00-19:00",
+			HappyHoursDiscount: "20%",
+			FiftyOffDiscount:   "50%",
+			Timezone:           "Local",
+		},
+		Order: OrderConfig{
+			MaxQuantity:    100,
+			IdempotencyTTL: 24 * time.Hour,
+		},
+		Product: ProductConfig{
+			Categories: []string{"Waffle", "Crème Brûlée", "Macaron", "Tiramisu", "Baklava", "Pie", "Cake", "Brownie", "Panna Cotta"},
+		},
+	}
 	iniFile, err := ini.Load(path)
 	if err != nil {
 		log.Fatalf("Fail to read config file: %v", err)
@@ -0,0 +1,126 @@
+// Package coupon normalizes and validates coupon codes before they are
+// looked up in the coupon index.
+package coupon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"order-food-api/core/couponindex"
+	"order-food-api/core/couponkey"
+)
+
+var (
+	ErrTooShort    = errors.New("coupon code is too short")
+	ErrTooLong     = errors.New("coupon code is too long")
+	ErrBadCharset  = errors.New("coupon code contains invalid characters")
+	ErrNotFound    = errors.New("coupon code not found")
+	ErrSingleFile  = errors.New("coupon code found in too few coupon files")
+	ErrUnavailable = errors.New("coupon validation unavailable")
+
+	ErrExhausted        = errors.New("coupon has reached its usage limit")
+	ErrCustomerLimit    = errors.New("coupon usage limit reached for this customer")
+	ErrCustomerRequired = errors.New("coupon requires a customer ID")
+)
+
+// Case policies applied to a code before it is checked.
+const (
+	CaseUpper    = "upper"
+	CasePreserve = "preserve"
+)
+
+// Cache is the coupon index a Validator looks codes up in.
+type Cache interface {
+	AppearsInAtLeastN(code string, n int) bool
+	Status() couponindex.Status
+}
+
+type Rules struct {
+	MinLen   int
+	MaxLen   int
+	Alphabet string
+	// Case is CaseUpper or CasePreserve. The coupon files are upper case,
+	// so preserving case only accepts codes already typed that way.
+	Case string
+	// MinFiles is the number of coupon files a code must appear in.
+	MinFiles int
+}
+
+func DefaultRules() Rules {
+	return Rules{
+		MinLen:   couponkey.MinLen,
+		MaxLen:   couponkey.MaxLen,
+		Alphabet: couponkey.Alphabet,
+		Case:     CaseUpper,
+		MinFiles: 2,
+	}
+}
+
+type Validator struct {
+	cache Cache
+	rules Rules
+}
+
+func NewValidator(cache Cache, rules Rules) (*Validator, error) {
+	switch rules.Case {
+	case CaseUpper, CasePreserve:
+	default:
+		return nil, fmt.Errorf("unknown coupon case policy %q (available: %s, %s)", rules.Case, CaseUpper, CasePreserve)
+	}
+	return &Validator{cache: cache, rules: rules}, nil
+}
+
+func (v *Validator) Rules() Rules {
+	return v.rules
+}
+
+// Normalize trims surrounding whitespace and applies the case policy.
+func (v *Validator) Normalize(code string) string {
+	code = strings.TrimSpace(code)
+	if v.rules.Case == CaseUpper {
+		code = strings.ToUpper(code)
+	}
+	return code
+}
+
+// Validate normalizes code and checks it against the rules and the cache.
+// It returns the normalized code, or "" with a nil error when no coupon was
+// given. Errors are one of the Err values of this package.
+func (v *Validator) Validate(code string) (string, error) {
+	code = v.Normalize(code)
+	if code == "" {
+		return "", nil
+	}
+
+	if err := v.check(code); err != nil {
+		return "", err
+	}
+
+	if !v.cache.Status().Ready() {
+		return "", ErrUnavailable
+	}
+	if !v.cache.AppearsInAtLeastN(code, v.rules.MinFiles) {
+		if v.rules.MinFiles > 1 && v.cache.AppearsInAtLeastN(code, 1) {
+			return "", ErrSingleFile
+		}
+		return "", ErrNotFound
+	}
+	return code, nil
+}
+
+// check validates the format of a normalized code.
+func (v *Validator) check(code string) error {
+	if len(code) < v.rules.MinLen {
+		return ErrTooShort
+	}
+	if len(code) > v.rules.MaxLen {
+		return ErrTooLong
+	}
+	for _, r := range code {
+		if !strings.ContainsRune(v.rules.Alphabet, r) {
+			return ErrBadCharset
+		}
+	}
+	return nil
+}
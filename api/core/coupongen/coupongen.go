@@ -0,0 +1,380 @@
+// Package coupongen deterministically generates gzip coupon files shaped like
+// the couponbase files, along with the ground truth of which codes appear in
+// how many files, so coupon backends can be validated without the real data.
+package coupongen
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"order-food-api/core/couponkey"
+)
+
+type Config struct {
+	Files        int
+	CodesPerFile int
+	Alphabet     string
+	// Lengths weights code lengths, e.g. {8: 1, 9: 1, 10: 1}.
+	Lengths map[int]float64
+	// Overlap is the fraction of each file's codes that also appear in at
+	// least one other file.
+	Overlap float64
+	// Duplicates is the fraction of lines repeating a code already written
+	// to the same file.
+	Duplicates float64
+	// Noise is the fraction of lines that are not valid coupon codes
+	// (too short, too long or outside the alphabet).
+	Noise float64
+	Seed  int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Files:        3,
+		CodesPerFile: 1_000_000,
+		Alphabet:     couponkey.Alphabet,
+		Lengths:      map[int]float64{8: 1, 9: 1, 10: 1},
+		Overlap:      0.05,
+		Duplicates:   0.01,
+		Noise:        0.01,
+		Seed:         1,
+	}
+}
+
+// Corpus describes generated files. Every code that appears in more than
+// one file is in Shared; all other valid codes appear in exactly one file.
+type Corpus struct {
+	Files  []string
+	Shared map[string]int
+	// Singles holds a sample of codes found in exactly one file.
+	Singles []string
+
+	gen *codeGen
+}
+
+const singlesSample = 10_000
+
+// Generate writes cfg.Files files named couponbase<N>.gz to dir.
+func Generate(dir string, cfg Config) (*Corpus, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	gen, err := newCodeGen(cfg, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	// Shared codes go to a random subset of 2..Files files, preferring
+	// files that do not hold their share yet, until every file does.
+	sharedPerFile := int(float64(cfg.CodesPerFile) * cfg.Overlap)
+	perFile := make([][]string, cfg.Files)
+	shared := make(map[string]int)
+	for cfg.Files > 1 && !filled(perFile, sharedPerFile) {
+		code, ok := gen.next()
+		if !ok {
+			return nil, errCodeSpace
+		}
+		k := 2 + rng.Intn(cfg.Files-1)
+		order := rng.Perm(cfg.Files)
+		sort.SliceStable(order, func(i, j int) bool {
+			return len(perFile[order[i]]) < sharedPerFile && len(perFile[order[j]]) >= sharedPerFile
+		})
+		for _, f := range order[:k] {
+			perFile[f] = append(perFile[f], code)
+		}
+		shared[code] = k
+	}
+	for _, codes := range perFile {
+		if len(codes) > cfg.CodesPerFile {
+			return nil, errors.New("overlap too high for the number of codes per file")
+		}
+	}
+
+	c := &Corpus{Shared: shared, gen: gen}
+	for i := 0; i < cfg.Files; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("couponbase%d.gz", i+1))
+		if err := c.writeFile(path, cfg, rng, perFile[i]); err != nil {
+			return nil, err
+		}
+		c.Files = append(c.Files, path)
+	}
+	return c, nil
+}
+
+func filled(perFile [][]string, n int) bool {
+	for _, codes := range perFile {
+		if len(codes) < n {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Corpus) writeFile(path string, cfg Config, rng *rand.Rand, shared []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	w := bufio.NewWriterSize(gz, 1<<20)
+
+	var written []string
+	remainingShared := len(shared)
+	for line := 0; line < cfg.CodesPerFile; line++ {
+		remaining := cfg.CodesPerFile - line
+		var code string
+		switch r := rng.Float64(); {
+		case remainingShared > 0 && rng.Intn(remaining) < remainingShared:
+			code = shared[len(shared)-remainingShared]
+			remainingShared--
+		case r < cfg.Noise:
+			code = noise(rng, cfg.Alphabet)
+		case r < cfg.Noise+cfg.Duplicates && len(written) > 0:
+			code = written[rng.Intn(len(written))]
+		default:
+			var ok bool
+			if code, ok = c.gen.next(); !ok {
+				return errCodeSpace
+			}
+			if len(c.Singles) < singlesSample {
+				c.Singles = append(c.Singles, code)
+			}
+		}
+		if len(written) < singlesSample {
+			written = append(written, code)
+		}
+		w.WriteString(code)
+		w.WriteByte('\n')
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// AtLeast returns the sorted codes found in at least n files.
+func (c *Corpus) AtLeast(n int) []string {
+	var codes []string
+	for code, count := range c.Shared {
+		if count >= n {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Absent returns n valid-looking codes that appear in none of the files,
+// or fewer if the code space runs out.
+func (c *Corpus) Absent(n int) []string {
+	codes := make([]string, 0, n)
+	for len(codes) < n {
+		code, ok := c.gen.next()
+		if !ok {
+			break
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// WriteTruth writes the codes found in at least n files, one per line
+// followed by a tab and the number of files containing it.
+func (c *Corpus) WriteTruth(path string, n int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, code := range c.AtLeast(n) {
+		fmt.Fprintf(w, "%s\t%d\n", code, c.Shared[code])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (cfg Config) validate() error {
+	switch {
+	case cfg.Files < 1:
+		return errors.New("at least one file is required")
+	case cfg.CodesPerFile < 1:
+		return errors.New("at least one code per file is required")
+	case len(cfg.Alphabet) < 2 || strings.ContainsAny(cfg.Alphabet, "\n\r"):
+		return errors.New("alphabet needs at least two printable characters")
+	case len(cfg.Lengths) == 0:
+		return errors.New("at least one code length is required")
+	case cfg.Overlap < 0 || cfg.Overlap > 1:
+		return errors.New("overlap must be between 0 and 1")
+	case cfg.Noise < 0 || cfg.Duplicates < 0 || cfg.Noise+cfg.Duplicates+cfg.Overlap > 1:
+		return errors.New("overlap, noise and duplicates must add up to at most 1")
+	}
+
+	// Every line may need a new code, so the lengths together must have
+	// at least that many.
+	need := uint64(cfg.Files) * uint64(cfg.CodesPerFile)
+	space := uint64(0)
+	for length, weight := range cfg.Lengths {
+		if length < 1 || weight <= 0 {
+			return fmt.Errorf("invalid weight for length %d", length)
+		}
+		size, ok := codeSpace(len(cfg.Alphabet), length)
+		if !ok || size >= need-space {
+			return nil
+		}
+		space += size
+	}
+	return fmt.Errorf("only %d distinct codes of the given lengths over a %d character alphabet, %d needed",
+		space, len(cfg.Alphabet), need)
+}
+
+var errCodeSpace = errors.New("coupongen: code space exhausted")
+
+// codeSpace returns alphabet^length, reporting false if it overflows.
+func codeSpace(alphabet, length int) (uint64, bool) {
+	size := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(size, uint64(alphabet))
+		if hi != 0 {
+			return 0, false
+		}
+		size = lo
+	}
+	return size, true
+}
+
+// codeGen yields distinct codes. Each length has its own counter that is
+// mapped through a bijection of [0, alphabet^length) before being written in
+// base len(alphabet), so codes look random but never repeat. Once a length
+// runs out, its draws go to the other lengths.
+type codeGen struct {
+	rng      *rand.Rand
+	alphabet string
+	lengths  []int
+	weights  []float64
+	classes  map[int]*lengthClass
+}
+
+type lengthClass struct {
+	size, mul, add, next uint64
+}
+
+func newCodeGen(cfg Config, rng *rand.Rand) (*codeGen, error) {
+	g := &codeGen{rng: rng, alphabet: cfg.Alphabet, classes: make(map[int]*lengthClass)}
+	for length := range cfg.Lengths {
+		g.lengths = append(g.lengths, length)
+	}
+	sort.Ints(g.lengths)
+
+	for _, length := range g.lengths {
+		if length < 1 || cfg.Lengths[length] <= 0 {
+			return nil, fmt.Errorf("invalid weight for length %d", length)
+		}
+		size, ok := codeSpace(len(cfg.Alphabet), length)
+		if !ok {
+			return nil, fmt.Errorf("length %d too long for a %d character alphabet", length, len(cfg.Alphabet))
+		}
+		mul := rng.Uint64()%size | 1
+		for gcd(mul, size) != 1 {
+			mul += 2
+		}
+		g.classes[length] = &lengthClass{size: size, mul: mul % size, add: rng.Uint64() % size}
+		g.weights = append(g.weights, cfg.Lengths[length])
+	}
+	return g, nil
+}
+
+// next returns a code not returned before, or false once every code of
+// every length is used.
+func (g *codeGen) next() (string, bool) {
+	length := g.pickLength()
+	class := g.classes[length]
+	if class.next == class.size {
+		if length, class = g.remaining(); class == nil {
+			return "", false
+		}
+	}
+
+	hi, lo := bits.Mul64(class.next, class.mul)
+	_, v := bits.Div64(hi, lo, class.size)
+	v = (v + class.add) % class.size
+	class.next++
+
+	b := make([]byte, length)
+	base := uint64(len(g.alphabet))
+	for i := length - 1; i >= 0; i-- {
+		b[i] = g.alphabet[v%base]
+		v /= base
+	}
+	return string(b), true
+}
+
+// remaining returns the shortest length that still has unused codes.
+func (g *codeGen) remaining() (int, *lengthClass) {
+	for _, length := range g.lengths {
+		if class := g.classes[length]; class.next < class.size {
+			return length, class
+		}
+	}
+	return 0, nil
+}
+
+func (g *codeGen) pickLength() int {
+	total := 0.0
+	for _, w := range g.weights {
+		total += w
+	}
+	r := g.rng.Float64() * total
+	for i, w := range g.weights {
+		if r < w {
+			return g.lengths[i]
+		}
+		r -= w
+	}
+	return g.lengths[len(g.lengths)-1]
+}
+
+// noise returns a line that is not a valid coupon code.
+func noise(rng *rand.Rand, alphabet string) string {
+	length := 1 + rng.Intn(couponkey.MinLen-1)
+	if rng.Intn(2) == 0 {
+		length = couponkey.MaxLen + 1 + rng.Intn(10)
+	}
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = alphabet[rng.Intn(len(alphabet))]
+	}
+	if rng.Intn(4) == 0 {
+		b[rng.Intn(len(b))] = '-'
+	}
+	return string(b)
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,59 @@
+package coupongen
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"testing"
+)
+
+func TestGenerateRejectsSmallCodeSpace(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Alphabet = "AB"
+	cfg.Lengths = map[int]float64{2: 1}
+	cfg.CodesPerFile = 10
+
+	if _, err := Generate(t.TempDir(), cfg); err == nil {
+		t.Fatal("Generate accepted 30 lines over 4 possible codes")
+	}
+}
+
+// TestGenerateUsesWholeCodeSpace fills every code of every length: draws
+// of an exhausted length must move to the others instead of panicking.
+func TestGenerateUsesWholeCodeSpace(t *testing.T) {
+	cfg := Config{
+		Files:        1,
+		CodesPerFile: 4 + 8,
+		Alphabet:     "AB",
+		Lengths:      map[int]float64{2: 10, 3: 1},
+		Seed:         1,
+	}
+	corpus, err := Generate(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(corpus.Files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for s := bufio.NewScanner(gz); s.Scan(); {
+		if seen[s.Text()] {
+			t.Fatalf("code %s written twice", s.Text())
+		}
+		seen[s.Text()] = true
+	}
+	if len(seen) != cfg.CodesPerFile {
+		t.Fatalf("%d distinct codes, want %d", len(seen), cfg.CodesPerFile)
+	}
+
+	if absent := corpus.Absent(5); len(absent) != 0 {
+		t.Fatalf("Absent returned %v from an exhausted code space", absent)
+	}
+}
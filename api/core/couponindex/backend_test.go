@@ -0,0 +1,173 @@
+package couponindex_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "order-food-api/core/cacheBitmap"
+	_ "order-food-api/core/cacheBloomFilter"
+	_ "order-food-api/core/cacheExact"
+	_ "order-food-api/core/cacheMPH"
+	_ "order-food-api/core/cacheMap"
+	_ "order-food-api/core/cacheSlice"
+	_ "order-food-api/core/cacheTrie"
+
+	"order-food-api/core/coupongen"
+	"order-food-api/core/couponindex"
+)
+
+// backends are the backends that load plain coupon files. Probabilistic
+// ones may find a code that is in no file.
+var backends = []struct {
+	name          string
+	probabilistic bool
+}{
+	{"bitmap", true},
+	{"bloom", true},
+	{"exact", false},
+	{"map", false},
+	{"mph", false},
+	{"slice", false},
+	{"trie", false},
+}
+
+// load builds backend name from files with stdout discarded, as loaders
+// log every chunk. Queries may run while it loads.
+func load(tb testing.TB, name string, files []string) couponindex.Index {
+	tb.Helper()
+	idx, err := couponindex.New(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := loadQuiet(idx, files); err != nil {
+		tb.Fatal(err)
+	}
+	return idx
+}
+
+func loadQuiet(idx couponindex.Index, files []string) error {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+	return idx.LoadFiles(files)
+}
+
+// TestQueryDuringLoad runs queries while files are loaded; run it with
+// -race to check that every backend publishes its structures race-free.
+func TestQueryDuringLoad(t *testing.T) {
+	cfg := coupongen.DefaultConfig()
+	cfg.CodesPerFile = 20_000
+	corpus, err := coupongen.Generate(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := corpus.AtLeast(2)
+	absent := corpus.Absent(1000)
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			idx, err := couponindex.New(backend.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer idx.Close()
+
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := i; ; j++ {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						idx.AppearsInAtLeastN(shared[j%len(shared)], 2)
+						idx.AppearsInAtLeastN(absent[j%len(absent)], 1)
+						idx.Stats()
+						idx.Status()
+						if e, ok := idx.(couponindex.Estimator); ok {
+							e.FalsePositiveRate(2)
+						}
+					}
+				}(i)
+			}
+
+			err = loadQuiet(idx, corpus.Files)
+			close(done)
+			wg.Wait()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := idx.Stats().Files; got != len(corpus.Files) {
+				t.Fatalf("Stats().Files = %d, want %d", got, len(corpus.Files))
+			}
+			for _, code := range shared {
+				if !idx.AppearsInAtLeastN(code, corpus.Shared[code]) {
+					t.Fatalf("%s not found in %d files", code, corpus.Shared[code])
+				}
+			}
+			// A probabilistic backend may accept an absent code, but hardly
+			// ever at this fill.
+			falsePositives := 0
+			for _, code := range absent {
+				if idx.AppearsInAtLeastN(code, 1) {
+					falsePositives++
+				}
+			}
+			if falsePositives > 0 && !backend.probabilistic || falsePositives > 1 {
+				t.Fatalf("%d of %d absent codes found", falsePositives, len(absent))
+			}
+		})
+	}
+}
+
+// TestLookupDistinguishesPadding checks that a code is not confused with
+// the same code followed by the first alphabet character.
+func TestLookupDistinguishesPadding(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.gz", "b.gz"} {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte("ABCDEFGH\n12345678Z\n"))
+		zw.Close()
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			idx := load(t, backend.name, files)
+			defer idx.Close()
+
+			for code, want := range map[string]bool{
+				"ABCDEFGH":   true,
+				"ABCDEFGH0":  false,
+				"ABCDEFGH00": false,
+				"12345678Z":  true,
+				"12345678Z0": false,
+				"ABCD-FGH":   false,
+			} {
+				if got := idx.AppearsInAtLeastN(code, 2); got != want {
+					t.Errorf("AppearsInAtLeastN(%q, 2) = %v, want %v", code, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package couponindex_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"order-food-api/core/coupongen"
+)
+
+const (
+	benchCodesPerFile = 100_000
+	benchMinFiles     = 2
+)
+
+var (
+	benchOnce   sync.Once
+	benchDir    string
+	benchCorpus *coupongen.Corpus
+	benchValid  []string
+	benchAbsent []string
+	benchErr    error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchDir != "" {
+		os.RemoveAll(benchDir)
+	}
+	os.Exit(code)
+}
+
+// corpus generates the synthetic coupon files shared by all benchmarks.
+func corpus(b *testing.B) *coupongen.Corpus {
+	benchOnce.Do(func() {
+		benchDir, benchErr = os.MkdirTemp("", "couponindex-bench-")
+		if benchErr != nil {
+			return
+		}
+		cfg := coupongen.DefaultConfig()
+		cfg.CodesPerFile = benchCodesPerFile
+		benchCorpus, benchErr = coupongen.Generate(benchDir, cfg)
+		if benchErr != nil {
+			return
+		}
+		benchValid = benchCorpus.AtLeast(benchMinFiles)
+		benchAbsent = benchCorpus.Absent(100_000)
+	})
+	if benchErr != nil {
+		b.Fatal(benchErr)
+	}
+	return benchCorpus
+}
+
+func BenchmarkLoad(b *testing.B) {
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			files := corpus(b).Files
+			for i := 0; i < b.N; i++ {
+				load(b, backend.name, files).Close()
+			}
+		})
+	}
+}
+
+func BenchmarkLookupHit(b *testing.B) {
+	benchLookup(b, func() []string { return benchValid })
+}
+
+func BenchmarkLookupMiss(b *testing.B) {
+	benchLookup(b, func() []string { return benchAbsent })
+}
+
+func benchLookup(b *testing.B, codes func() []string) {
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			idx := load(b, backend.name, corpus(b).Files)
+			defer idx.Close()
+			codes := codes()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				idx.AppearsInAtLeastN(codes[i%len(codes)], benchMinFiles)
+			}
+		})
+	}
+}
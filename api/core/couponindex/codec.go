@@ -0,0 +1,174 @@
+package couponindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// maxSnapshotLen bounds any length prefix read from a snapshot so a corrupt
+// file fails to decode instead of allocating unbounded memory.
+const maxSnapshotLen = 1 << 33
+
+var errSnapshotLen = errors.New("snapshot length out of range")
+
+// SnapshotWriter writes the values backends use in their snapshot payload.
+// The first error is kept and returned by Err; later writes are no-ops.
+type SnapshotWriter struct {
+	w   io.Writer
+	err error
+}
+
+func NewSnapshotWriter(w io.Writer) *SnapshotWriter {
+	return &SnapshotWriter{w: w}
+}
+
+func (w *SnapshotWriter) Uint64(v uint64) {
+	w.write(v)
+}
+
+// Len writes a length prefix, such as the number of entries that follow.
+func (w *SnapshotWriter) Len(n int) {
+	w.Uint64(uint64(n))
+}
+
+func (w *SnapshotWriter) Bytes(b []byte) {
+	w.Uint64(uint64(len(b)))
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+func (w *SnapshotWriter) String(s string) {
+	w.Bytes([]byte(s))
+}
+
+func (w *SnapshotWriter) Uint32s(v []uint32) {
+	w.Uint64(uint64(len(v)))
+	w.write(v)
+}
+
+func (w *SnapshotWriter) Uint64s(v []uint64) {
+	w.Uint64(uint64(len(v)))
+	w.write(v)
+}
+
+// Raw writes b as is, for fixed-size values the reader knows the length of.
+func (w *SnapshotWriter) Raw(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+// WriterTo writes a length-prefixed value serialized by its own WriteTo.
+func (w *SnapshotWriter) WriterTo(v io.WriterTo) {
+	if w.err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	if _, err := v.WriteTo(&buf); err != nil {
+		w.err = err
+		return
+	}
+	w.Bytes(buf.Bytes())
+}
+
+func (w *SnapshotWriter) Err() error {
+	return w.err
+}
+
+func (w *SnapshotWriter) write(v any) {
+	if w.err == nil {
+		w.err = binary.Write(w.w, binary.LittleEndian, v)
+	}
+}
+
+// SnapshotReader is the counterpart of SnapshotWriter.
+type SnapshotReader struct {
+	r   io.Reader
+	err error
+}
+
+func NewSnapshotReader(r io.Reader) *SnapshotReader {
+	return &SnapshotReader{r: r}
+}
+
+func (r *SnapshotReader) Uint64() uint64 {
+	var v uint64
+	r.read(&v)
+	return v
+}
+
+func (r *SnapshotReader) Bytes() []byte {
+	n := r.length()
+	if r.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, b)
+	return b
+}
+
+func (r *SnapshotReader) String() string {
+	return string(r.Bytes())
+}
+
+func (r *SnapshotReader) Uint32s() []uint32 {
+	n := r.length()
+	if r.err != nil {
+		return nil
+	}
+	v := make([]uint32, n)
+	r.read(v)
+	return v
+}
+
+func (r *SnapshotReader) Uint64s() []uint64 {
+	n := r.length()
+	if r.err != nil {
+		return nil
+	}
+	v := make([]uint64, n)
+	r.read(v)
+	return v
+}
+
+// Raw fills b with the next len(b) bytes.
+func (r *SnapshotReader) Raw(b []byte) {
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, b)
+	}
+}
+
+// ReaderFrom reads a value written by SnapshotWriter.WriterTo into v.
+func (r *SnapshotReader) ReaderFrom(v io.ReaderFrom) {
+	b := r.Bytes()
+	if r.err != nil {
+		return
+	}
+	_, r.err = v.ReadFrom(bytes.NewReader(b))
+}
+
+// Len reads a length prefix, such as the number of entries that follow.
+func (r *SnapshotReader) Len() int {
+	return int(r.length())
+}
+
+func (r *SnapshotReader) Err() error {
+	return r.err
+}
+
+func (r *SnapshotReader) length() uint64 {
+	n := r.Uint64()
+	if r.err == nil && n > maxSnapshotLen {
+		r.err = errSnapshotLen
+	}
+	return n
+}
+
+func (r *SnapshotReader) read(v any) {
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.LittleEndian, v)
+	}
+}
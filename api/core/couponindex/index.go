@@ -0,0 +1,18 @@
+package couponindex
+
+// Index is a coupon code lookup structure built from one or more coupon files.
+type Index interface {
+	LoadFiles(files []string) error
+	AppearsInAtLeastN(code string, n int) bool
+	Stats() Stats
+	Status() Status
+	Close() error
+}
+
+// Stats describes what an index currently holds in memory.
+type Stats struct {
+	Backend    string `json:"backend"`
+	Files      int    `json:"files"`
+	Codes      int64  `json:"codes"`
+	Structures int    `json:"structures"`
+}
@@ -0,0 +1,68 @@
+package couponindex
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// ReadChunks streams the gzip coupon file at path and hands its lines to
+// emit in chunks of chunkSize. Every chunk is a fresh slice owned by emit.
+// Progress is reported to t.
+func ReadChunks(path string, chunkSize int, t *Tracker, emit func(lines []string)) (err error) {
+	defer func() {
+		t.EndFile(path, err)
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	t.BeginFile(path, info.Size())
+
+	counter := &countingReader{r: f}
+	r, err := gzip.NewReader(counter)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	var lines int64
+	var chunk []string
+	for scanner.Scan() {
+		chunk = append(chunk, scanner.Text())
+		lines++
+		if len(chunk) >= chunkSize {
+			emit(chunk)
+			chunk = nil
+			t.Progress(path, lines, counter.n)
+		}
+	}
+	if len(chunk) > 0 {
+		emit(chunk)
+	}
+	t.Progress(path, lines, counter.n)
+
+	return scanner.Err()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
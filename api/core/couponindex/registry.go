@@ -0,0 +1,55 @@
+package couponindex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Factory func() Index
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a backend available under name. It is meant to be called
+// from the init function of the backend package.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("couponindex: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("couponindex: Register called twice for backend " + name)
+	}
+	registry[name] = factory
+}
+
+// New creates an empty index of the named backend.
+func New(name string) (Index, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown coupon backend %q (available: %s)", name, strings.Join(Backends(), ", "))
+	}
+	return factory(), nil
+}
+
+// Backends returns the sorted names of all registered backends.
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
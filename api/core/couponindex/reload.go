@@ -0,0 +1,189 @@
+package couponindex
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+var ErrReloadInProgress = errors.New("coupon reload already in progress")
+
+// LoadFunc fills a freshly created index from files, e.g. Load with a
+// snapshot directory.
+type LoadFunc func(idx Index, files []string) error
+
+// Reloader is an Index that serves lookups from the current index while a
+// replacement is built in the background, then swaps it in atomically. A
+// failed reload keeps the previous index.
+type Reloader struct {
+	backend string
+	load    LoadFunc
+	verify  func() (Verifier, error)
+	current atomic.Pointer[holder]
+	next    atomic.Pointer[holder]
+	busy    atomic.Bool
+}
+
+type holder struct {
+	Index
+}
+
+func NewReloader(backend string, load LoadFunc) (*Reloader, error) {
+	if _, err := New(backend); err != nil {
+		return nil, err
+	}
+	return &Reloader{backend: backend, load: load}, nil
+}
+
+// VerifyWith makes every index built from now on confirm its positive
+// lookups with a verifier returned by open, opened at the start of each
+// reload so the index and its verifier are swapped in together. It must be
+// called before the first reload.
+func (r *Reloader) VerifyWith(open func() (Verifier, error)) {
+	r.verify = open
+}
+
+// LoadFiles is Reload, so a Reloader can stand in for any Index.
+func (r *Reloader) LoadFiles(files []string) error {
+	return r.Reload(files)
+}
+
+// Reload builds a new index from files and swaps it in once it is ready.
+// It returns ErrReloadInProgress if another reload is running.
+func (r *Reloader) Reload(files []string) error {
+	if !r.busy.CompareAndSwap(false, true) {
+		return ErrReloadInProgress
+	}
+	defer r.busy.Store(false)
+	return r.reload(files)
+}
+
+// ReloadAsync starts Reload in the background and logs its outcome.
+func (r *Reloader) ReloadAsync(files []string) error {
+	if !r.busy.CompareAndSwap(false, true) {
+		return ErrReloadInProgress
+	}
+	go func() {
+		defer r.busy.Store(false)
+		if err := r.reload(files); err != nil {
+			log.Printf("Coupon reload failed: %v", err)
+			return
+		}
+		log.Printf("Coupon reload done: %+v", r.Stats())
+	}()
+	return nil
+}
+
+func (r *Reloader) reload(files []string) error {
+	idx, err := New(r.backend)
+	if err != nil {
+		return err
+	}
+
+	served := Index(idx)
+	if r.verify != nil {
+		v, err := r.verify()
+		if err != nil {
+			return r.fail(files, fmt.Errorf("open coupon verifier: %w", err))
+		}
+		served = Verify(idx, v)
+	}
+
+	h := &holder{served}
+	// Without a usable index there is nothing to protect, so expose the new
+	// one right away and let its status show the load progress.
+	if cur := r.current.Load(); cur == nil || !cur.Status().Ready() {
+		r.current.Store(h)
+	} else {
+		r.next.Store(h)
+		defer r.next.Store(nil)
+	}
+
+	if err := r.load(idx, files); err != nil {
+		return err
+	}
+
+	// The replaced index and its verifier are not closed: in-flight lookups
+	// may still hold them, and the GC reclaims them once they are done.
+	r.current.Store(h)
+	return nil
+}
+
+// fail returns err of a reload that could not start loading. Before the
+// first load, it also exposes a failed index so Status reports why nothing
+// is being served.
+func (r *Reloader) fail(files []string, err error) error {
+	if r.current.Load() == nil {
+		failed := &failedIndex{backend: r.backend}
+		failed.tracker.Begin(files)
+		failed.tracker.Finish(err)
+		r.current.CompareAndSwap(nil, &holder{failed})
+	}
+	return err
+}
+
+// failedIndex is an empty index whose load failed before it started.
+type failedIndex struct {
+	backend string
+	tracker Tracker
+}
+
+func (f *failedIndex) LoadFiles(files []string) error            { return errors.New(f.tracker.Status().Error) }
+func (f *failedIndex) AppearsInAtLeastN(code string, n int) bool { return false }
+func (f *failedIndex) Stats() Stats                              { return Stats{Backend: f.backend} }
+func (f *failedIndex) Status() Status                            { return f.tracker.Status() }
+func (f *failedIndex) Close() error                              { return nil }
+
+func (r *Reloader) AppearsInAtLeastN(code string, n int) bool {
+	cur := r.current.Load()
+	return cur != nil && cur.AppearsInAtLeastN(code, n)
+}
+
+// Status is the status of the index serving lookups. While a replacement is
+// being built, its progress is reported in Next.
+func (r *Reloader) Status() Status {
+	var status Status
+	if cur := r.current.Load(); cur != nil {
+		status = cur.Status()
+	} else {
+		status.State = StatePending
+	}
+	if next := r.next.Load(); next != nil {
+		nextStatus := next.Status()
+		status.Next = &nextStatus
+	}
+	return status
+}
+
+func (r *Reloader) Stats() Stats {
+	if cur := r.current.Load(); cur != nil {
+		return cur.Stats()
+	}
+	return Stats{Backend: r.backend}
+}
+
+func (r *Reloader) Close() error {
+	if cur := r.current.Swap(nil); cur != nil {
+		return cur.Close()
+	}
+	return nil
+}
+
+// Current returns the index serving lookups, or nil before the first load.
+func (r *Reloader) Current() Index {
+	if cur := r.current.Load(); cur != nil {
+		return cur.Index
+	}
+	return nil
+}
+
+// FalsePositiveRate forwards to the current index when it is an Estimator.
+func (r *Reloader) FalsePositiveRate(n int) float64 {
+	if cur := r.current.Load(); cur != nil {
+		if e, ok := cur.Index.(Estimator); ok {
+			return e.FalsePositiveRate(n)
+		}
+	}
+	return 0
+}
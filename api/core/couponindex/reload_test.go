@@ -0,0 +1,98 @@
+package couponindex
+
+import (
+	"errors"
+	"testing"
+)
+
+// acceptAll is an index that finds every code, like a saturated filter.
+type acceptAll struct{ tracker Tracker }
+
+func (a *acceptAll) LoadFiles(files []string) error {
+	a.tracker.Begin(files)
+	a.tracker.Finish(nil)
+	return nil
+}
+func (a *acceptAll) AppearsInAtLeastN(code string, n int) bool { return true }
+func (a *acceptAll) Stats() Stats                              { return Stats{Backend: "acceptall"} }
+func (a *acceptAll) Status() Status                            { return a.tracker.Status() }
+func (a *acceptAll) Close() error                              { return nil }
+
+func init() {
+	Register("acceptall", func() Index { return &acceptAll{} })
+}
+
+// knownCodes is a verifier that confirms a fixed set of codes.
+type knownCodes map[string]bool
+
+func (k knownCodes) Verify(code string, n int) (bool, error) {
+	return k[code], nil
+}
+
+func TestReloadSwapsVerifier(t *testing.T) {
+	r, err := NewReloader("acceptall", func(idx Index, files []string) error {
+		return idx.LoadFiles(files)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var verifier knownCodes
+	var openErr error
+	r.VerifyWith(func() (Verifier, error) { return verifier, openErr })
+
+	verifier = knownCodes{"OLDCODE1": true}
+	if err := r.Reload(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !r.AppearsInAtLeastN("OLDCODE1", 2) || r.AppearsInAtLeastN("NEWCODE1", 2) {
+		t.Fatal("first reload is not verified by the first verifier")
+	}
+
+	verifier = knownCodes{"OLDCODE1": true, "NEWCODE1": true}
+	if err := r.Reload(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !r.AppearsInAtLeastN("NEWCODE1", 2) {
+		t.Fatal("reload kept the stale verifier")
+	}
+
+	openErr = errors.New("stale")
+	verifier = knownCodes{}
+	if err := r.Reload(nil); !errors.Is(err, openErr) {
+		t.Fatalf("Reload() = %v, want the verifier error", err)
+	}
+	if !r.AppearsInAtLeastN("NEWCODE1", 2) {
+		t.Fatal("failed reload replaced the serving index and verifier")
+	}
+	if rate := r.FalsePositiveRate(2); rate != 0 {
+		t.Fatalf("FalsePositiveRate() = %v for a verified index", rate)
+	}
+}
+
+func TestFirstReloadFailureIsReported(t *testing.T) {
+	r, err := NewReloader("acceptall", func(idx Index, files []string) error {
+		return idx.LoadFiles(files)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	openErr := errors.New("stale")
+	r.VerifyWith(func() (Verifier, error) { return knownCodes{}, openErr })
+
+	if err := r.Reload([]string{"coupons.txt"}); !errors.Is(err, openErr) {
+		t.Fatalf("Reload() = %v, want the verifier error", err)
+	}
+	status := r.Status()
+	if status.State != StateFailed || status.Error == "" {
+		t.Fatalf("Status() = %+v, want failed with the error", status)
+	}
+
+	openErr = nil
+	if err := r.Reload([]string{"coupons.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Status().Ready() {
+		t.Fatalf("Status() = %+v after a successful reload, want ready", r.Status())
+	}
+}
@@ -0,0 +1,174 @@
+package couponindex
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	snapshotMagic = "CPNIDXSN"
+	// SnapshotVersion 3: mph and slice keys use couponkey.Encode.
+	SnapshotVersion = 3
+)
+
+var errSnapshotStale = errors.New("snapshot does not match coupon files")
+
+// Snapshotter is implemented by backends that can persist their built
+// structures and restore them without re-reading the coupon files.
+// ReadSnapshot must leave the index untouched when it returns an error.
+type Snapshotter interface {
+	WriteSnapshot(w io.Writer) error
+	ReadSnapshot(r io.Reader) error
+}
+
+// Source identifies the exact content of a coupon file a snapshot was built from.
+type Source struct {
+	File   string
+	Size   int64
+	SHA256 []byte
+}
+
+// Load restores idx from the snapshot in dir when it was written by the same
+// backend from unchanged coupon files. Otherwise it builds idx from files and
+// writes a fresh snapshot. With an empty dir, or a backend that does not
+// implement Snapshotter, it is the same as idx.LoadFiles(files).
+func Load(idx Index, files []string, dir string) error {
+	s, ok := idx.(Snapshotter)
+	if !ok || dir == "" {
+		return idx.LoadFiles(files)
+	}
+
+	sources, err := checksumSources(files)
+	if err != nil {
+		// Let LoadFiles report the unreadable file through the tracker.
+		return idx.LoadFiles(files)
+	}
+
+	path := filepath.Join(dir, idx.Stats().Backend+".snap")
+	err = readSnapshot(path, idx.Stats().Backend, sources, s)
+	if err == nil {
+		log.Printf("Loaded coupon snapshot %s", path)
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Rebuilding coupon index, snapshot %s unusable: %v", path, err)
+	}
+
+	if err := idx.LoadFiles(files); err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(path, idx.Stats().Backend, sources, s); err != nil {
+		log.Printf("Failed to write coupon snapshot %s: %v", path, err)
+	}
+	return nil
+}
+
+func checksumSources(files []string) ([]Source, error) {
+	sources := make([]Source, 0, len(files))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		size, err := io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, Source{File: file, Size: size, SHA256: h.Sum(nil)})
+	}
+	return sources, nil
+}
+
+func readSnapshot(path, backend string, sources []Source, s Snapshotter) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 1<<20)
+	r := NewSnapshotReader(br)
+
+	if magic := r.String(); r.Err() == nil && magic != snapshotMagic {
+		return errors.New("not a coupon snapshot")
+	}
+	if version := r.Uint64(); r.Err() == nil && version != SnapshotVersion {
+		return fmt.Errorf("snapshot version %d, want %d", version, SnapshotVersion)
+	}
+	if name := r.String(); r.Err() == nil && name != backend {
+		return fmt.Errorf("snapshot of backend %q, want %q", name, backend)
+	}
+
+	n := r.Len()
+	if r.Err() == nil && n != len(sources) {
+		return errSnapshotStale
+	}
+	for i := 0; i < n && r.Err() == nil; i++ {
+		file, size, sum := r.String(), int64(r.Uint64()), r.Bytes()
+		if r.Err() != nil {
+			break
+		}
+		if file != sources[i].File || size != sources[i].Size || string(sum) != string(sources[i].SHA256) {
+			return errSnapshotStale
+		}
+	}
+	if r.Err() != nil {
+		return r.Err()
+	}
+
+	return s.ReadSnapshot(br)
+}
+
+func writeSnapshot(path, backend string, sources []Source, s Snapshotter) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	bw := bufio.NewWriterSize(tmp, 1<<20)
+	w := NewSnapshotWriter(bw)
+	w.String(snapshotMagic)
+	w.Uint64(SnapshotVersion)
+	w.String(backend)
+	w.Len(len(sources))
+	for _, src := range sources {
+		w.String(src.File)
+		w.Uint64(uint64(src.Size))
+		w.Bytes(src.SHA256)
+	}
+	if err := w.Err(); err != nil {
+		return err
+	}
+
+	if err := s.WriteSnapshot(bw); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
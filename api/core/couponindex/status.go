@@ -0,0 +1,141 @@
+package couponindex
+
+import (
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	StatePending State = "pending"
+	StateLoading State = "loading"
+	StateReady   State = "ready"
+	StateFailed  State = "failed"
+)
+
+// FileStatus is the load progress of a single coupon file. A file is ready
+// once it has been read completely; the index as a whole only becomes ready
+// when every file has been read and indexed.
+type FileStatus struct {
+	File      string  `json:"file"`
+	State     State   `json:"state"`
+	Lines     int64   `json:"lines"`
+	BytesRead int64   `json:"bytesRead"`
+	Size      int64   `json:"size"`
+	Progress  float64 `json:"progress"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Status struct {
+	State      State        `json:"state"`
+	Error      string       `json:"error,omitempty"`
+	Files      []FileStatus `json:"files"`
+	StartedAt  time.Time    `json:"startedAt,omitzero"`
+	FinishedAt time.Time    `json:"finishedAt,omitzero"`
+	Next       *Status      `json:"next,omitempty"`
+}
+
+func (s Status) Ready() bool {
+	return s.State == StateReady
+}
+
+// Tracker records the load state of an index. The zero value is pending.
+type Tracker struct {
+	mu     sync.RWMutex
+	status Status
+}
+
+func (t *Tracker) Status() Status {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	status := t.status
+	if status.State == "" {
+		status.State = StatePending
+	}
+	status.Files = make([]FileStatus, len(t.status.Files))
+	copy(status.Files, t.status.Files)
+	for i, f := range status.Files {
+		if f.Size > 0 {
+			status.Files[i].Progress = float64(f.BytesRead) / float64(f.Size)
+		}
+	}
+	return status
+}
+
+// Begin marks the index as loading the given files.
+func (t *Tracker) Begin(files []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status = Status{
+		State:     StateLoading,
+		Files:     make([]FileStatus, len(files)),
+		StartedAt: time.Now(),
+	}
+	for i, file := range files {
+		t.status.Files[i] = FileStatus{File: file, State: StatePending}
+	}
+}
+
+func (t *Tracker) BeginFile(file string, size int64) {
+	t.update(file, func(f *FileStatus) {
+		f.State = StateLoading
+		f.Size = size
+	})
+}
+
+func (t *Tracker) Progress(file string, lines, bytesRead int64) {
+	t.update(file, func(f *FileStatus) {
+		f.Lines = lines
+		f.BytesRead = bytesRead
+	})
+}
+
+func (t *Tracker) EndFile(file string, err error) {
+	t.update(file, func(f *FileStatus) {
+		if err != nil {
+			f.State = StateFailed
+			f.Error = err.Error()
+			return
+		}
+		f.State = StateReady
+		f.BytesRead = f.Size
+	})
+}
+
+// Restored marks files as loaded at once, for an index restored from a snapshot.
+func (t *Tracker) Restored(files []string) {
+	t.Begin(files)
+	for _, file := range files {
+		t.EndFile(file, nil)
+	}
+	t.Finish(nil)
+}
+
+// Finish marks the whole load as ready, or failed when err is not nil.
+func (t *Tracker) Finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status.FinishedAt = time.Now()
+	if err != nil {
+		t.status.State = StateFailed
+		t.status.Error = err.Error()
+		return
+	}
+	t.status.State = StateReady
+}
+
+func (t *Tracker) update(file string, fn func(f *FileStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.status.Files {
+		if t.status.Files[i].File == file {
+			fn(&t.status.Files[i])
+			return
+		}
+	}
+}
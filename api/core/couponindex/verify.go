@@ -0,0 +1,83 @@
+package couponindex
+
+import (
+	"io"
+	"log"
+)
+
+// Estimator is implemented by probabilistic backends that can accept a code
+// which is not actually in the files.
+type Estimator interface {
+	// FalsePositiveRate estimates, from the current fill of the loaded
+	// structures, the probability that AppearsInAtLeastN(code, n) reports
+	// true for a code found in none of the files.
+	FalsePositiveRate(n int) float64
+}
+
+// AtLeastNRate returns the probability that at least n of the independent
+// per-file false positive rates fire at once.
+func AtLeastNRate(fileRates []float64, n int) float64 {
+	if n <= 0 {
+		return 1
+	}
+	// dist[k] is the probability that exactly k files match so far.
+	dist := make([]float64, len(fileRates)+1)
+	dist[0] = 1
+	for i, p := range fileRates {
+		for k := i + 1; k > 0; k-- {
+			dist[k] = dist[k]*(1-p) + dist[k-1]*p
+		}
+		dist[0] *= 1 - p
+	}
+
+	rate := 0.0
+	for k := n; k < len(dist); k++ {
+		rate += dist[k]
+	}
+	return rate
+}
+
+// Verifier confirms a positive lookup against an exact source.
+type Verifier interface {
+	Verify(code string, n int) (bool, error)
+}
+
+// Verified is an Index whose positive lookups are confirmed by a Verifier
+// before being reported, so a false positive of a probabilistic backend is
+// never accepted. Verification errors reject the code.
+type Verified struct {
+	Index
+	verifier Verifier
+}
+
+func Verify(idx Index, v Verifier) *Verified {
+	return &Verified{Index: idx, verifier: v}
+}
+
+func (v *Verified) AppearsInAtLeastN(code string, n int) bool {
+	if !v.Index.AppearsInAtLeastN(code, n) {
+		return false
+	}
+
+	ok, err := v.verifier.Verify(code, n)
+	if err != nil {
+		log.Printf("Coupon verification failed for %q: %v", code, err)
+		return false
+	}
+	return ok
+}
+
+// FalsePositiveRate is zero: every hit is confirmed by the verifier.
+func (v *Verified) FalsePositiveRate(n int) float64 {
+	return 0
+}
+
+func (v *Verified) Close() error {
+	err := v.Index.Close()
+	if c, ok := v.verifier.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
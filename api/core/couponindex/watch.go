@@ -0,0 +1,48 @@
+package couponindex
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Watch polls files every interval and calls onChange when any of them has
+// changed size or modification time and then stayed unchanged for one more
+// interval, so a file that is still being copied does not trigger a reload.
+// onChange reports whether it handled the change; a change it refused, e.g.
+// because a reload is already running, is offered again on the next tick.
+// It never returns.
+func Watch(files []string, interval time.Duration, onChange func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := fingerprint(files)
+	candidate := ""
+	for range ticker.C {
+		fp := fingerprint(files)
+		switch {
+		case fp == last:
+			candidate = ""
+		case fp == candidate:
+			if onChange() {
+				last, candidate = fp, ""
+			}
+		default:
+			candidate = fp
+		}
+	}
+}
+
+func fingerprint(files []string) string {
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing;", file)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
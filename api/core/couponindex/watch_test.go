@@ -0,0 +1,41 @@
+package couponindex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchOffersRefusedChangeAgain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "coupons.txt")
+	if err := os.WriteFile(file, []byte("AAAAAAAA\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(chan bool)
+	go Watch([]string{file}, 10*time.Millisecond, func() bool {
+		accepted := <-calls
+		return accepted
+	})
+	// Let Watch take its first fingerprint before the change.
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(file, []byte("AAAAAAAA\nBBBBBBBB\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first offer is refused as if a reload were running; the same
+	// change must be offered again and, once accepted, never again.
+	for _, accept := range []bool{false, true} {
+		select {
+		case calls <- accept:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("change not offered (accept %v)", accept)
+		}
+	}
+	select {
+	case calls <- true:
+		t.Fatal("accepted change offered again")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
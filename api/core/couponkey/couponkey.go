@@ -0,0 +1,134 @@
+package couponkey
+
+import (
+	"math/bits"
+	"slices"
+)
+
+const (
+	Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	MinLen   = 8
+	MaxLen   = 10
+
+	// MaxFiles is the number of coupon files a packed entry can record.
+	MaxFiles = 4
+
+	maskBits = 4
+	maskMask = 1<<maskBits - 1
+)
+
+var charValue [256]uint64
+
+func init() {
+	for i := 0; i < len(Alphabet); i++ {
+		charValue[Alphabet[i]] = uint64(i + 1)
+	}
+}
+
+// Encode packs a code of MinLen to MaxLen characters from Alphabet into the
+// low 60 bits of a uint64, 6 bits per character with 0 reserved for padding.
+// It is injective, so the backends storing keys never confuse two codes,
+// and ordering keys numerically orders the codes lexically.
+func Encode(code string) (uint64, bool) {
+	if len(code) < MinLen || len(code) > MaxLen {
+		return 0, false
+	}
+
+	var key uint64
+	for i := 0; i < len(code); i++ {
+		v := charValue[code[i]]
+		if v == 0 {
+			return 0, false
+		}
+		key = key<<6 | v
+	}
+	return key << (6 * (MaxLen - len(code))), true
+}
+
+// Decode is the inverse of Encode.
+func Decode(key uint64) string {
+	var buf [MaxLen]byte
+	n := 0
+	for i := MaxLen - 1; i >= 0; i-- {
+		v := (key >> (6 * i)) & 0x3f
+		if v == 0 {
+			break
+		}
+		buf[n] = Alphabet[v-1]
+		n++
+	}
+	return string(buf[:n])
+}
+
+// Pack combines a key with the bitmask of files that contain it. Packed
+// entries sort in the same order as their keys.
+func Pack(key uint64, mask uint8) uint64 {
+	return key<<maskBits | uint64(mask&maskMask)
+}
+
+func Unpack(entry uint64) (key uint64, mask uint8) {
+	return entry >> maskBits, uint8(entry & maskMask)
+}
+
+// FileCount returns how many files a packed entry was found in.
+func FileCount(entry uint64) int {
+	return bits.OnesCount64(entry & maskMask)
+}
+
+// Find binary searches sorted packed entries for key.
+func Find(entries []uint64, key uint64) (entry uint64, ok bool) {
+	lo, hi := 0, len(entries)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if entries[mid]>>maskBits < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(entries) && entries[lo]>>maskBits == key {
+		return entries[lo], true
+	}
+	return 0, false
+}
+
+// EncodeAll encodes the coupon codes among lines and returns their keys
+// sorted and without duplicates. Lines that are not coupon codes are
+// skipped, as they can never be looked up.
+func EncodeAll(lines []string) []uint64 {
+	keys := make([]uint64, 0, len(lines))
+	for _, line := range lines {
+		if key, ok := Encode(line); ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return slices.Clip(slices.Compact(keys))
+}
+
+// MergeSorted merges sorted key lists, e.g. the chunks of a file encoded
+// with EncodeAll, into one sorted list without duplicates.
+func MergeSorted(lists ...[]uint64) []uint64 {
+	n := 0
+	for _, list := range lists {
+		n += len(list)
+	}
+	merged := make([]uint64, 0, n)
+	next := make([]int, len(lists))
+	for {
+		first := -1
+		for i, list := range lists {
+			if next[i] < len(list) && (first < 0 || list[next[i]] < lists[first][next[first]]) {
+				first = i
+			}
+		}
+		if first < 0 {
+			return slices.Clip(merged)
+		}
+		key := lists[first][next[first]]
+		next[first]++
+		if len(merged) == 0 || merged[len(merged)-1] != key {
+			merged = append(merged, key)
+		}
+	}
+}
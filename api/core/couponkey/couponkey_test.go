@@ -0,0 +1,20 @@
+package couponkey
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeSorted(t *testing.T) {
+	a := EncodeAll([]string{"BBBBBBBB", "AAAAAAAA", "not a code", "BBBBBBBB"})
+	b := EncodeAll([]string{"CCCCCCCC", "AAAAAAAA"})
+
+	var codes []string
+	for _, key := range MergeSorted(a, nil, b) {
+		codes = append(codes, Decode(key))
+	}
+	want := []string{"AAAAAAAA", "BBBBBBBB", "CCCCCCCC"}
+	if !slices.Equal(codes, want) {
+		t.Fatalf("MergeSorted() = %v, want %v", codes, want)
+	}
+}
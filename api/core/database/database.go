@@ -24,7 +24,7 @@ func Connect(dbCfg config.DBConfig) *gorm.DB {
 	var err error
 
 	for i := 0; i < 5; i++ {
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
 		if err == nil {
 			break
 		}
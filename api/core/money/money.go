@@ -0,0 +1,133 @@
+// Package money represents prices as a whole number of cents, so totals and
+// discounts are computed exactly instead of with float64 rounding errors.
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Amount is a number of cents. It is encoded in JSON as a decimal number,
+// e.g. 12.5, and stored as decimal(12,2).
+type Amount int64
+
+func FromCents(cents int64) Amount {
+	return Amount(cents)
+}
+
+// Parse reads a decimal amount with at most two fractional digits.
+func Parse(raw string) (Amount, error) {
+	s := strings.TrimSpace(raw)
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || whole[0] < '0' || whole[0] > '9' || (hasFrac && frac == "") || len(frac) > 2 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, raw)
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, raw)
+	}
+	cents, err := strconv.ParseUint(frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, raw)
+	}
+
+	a := Amount(units*100 + int64(cents))
+	if neg {
+		a = -a
+	}
+	return a, nil
+}
+
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// Mul returns the amount multiplied by a quantity.
+func (a Amount) Mul(n int) Amount {
+	return a * Amount(n)
+}
+
+// Percent returns basisPoints/10000 of the amount, rounded half away from
+// zero to the nearest cent.
+func (a Amount) Percent(basisPoints int64) Amount {
+	p := int64(a) * basisPoints
+	if p < 0 {
+		return Amount((p - 5000) / 10000)
+	}
+	return Amount((p + 5000) / 10000)
+}
+
+func (a Amount) String() string {
+	sign := ""
+	c := int64(a)
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	v, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+func (Amount) GormDataType() string {
+	return "decimal(12,2)"
+}
+
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		*a = Amount(v * 100)
+	case float64:
+		*a = Amount(math.Round(v * 100))
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidAmount, src)
+	}
+	return nil
+}
+
+func (a *Amount) scanString(s string) error {
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
@@ -0,0 +1,108 @@
+package mph
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+)
+
+// maxSliceLen guards against corrupt input allocating unbounded memory.
+const maxSliceLen = 1 << 32
+
+var errTooLarge = errors.New("mph: serialized table too large")
+
+// WriteTo serializes the table in little endian, each slice length-prefixed.
+func (t *Table) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	for _, v := range []any{
+		uint64(len(t.keys)), t.keys,
+		uint64(len(t.level0)), t.level0, int64(t.level0Mask),
+		uint64(len(t.level1)), t.level1, int64(t.level1Mask),
+		uint64(len(t.Extra)), t.Extra,
+	} {
+		if err := binary.Write(cw, binary.LittleEndian, v); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
+
+// ReadFrom replaces t with a table written by WriteTo.
+func (t *Table) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countReader{r: r}
+	var table Table
+	var mask0, mask1 int64
+
+	if err := readUint64s(cr, &table.keys); err != nil {
+		return cr.n, err
+	}
+	if err := readUint32s(cr, &table.level0); err != nil {
+		return cr.n, err
+	}
+	if err := binary.Read(cr, binary.LittleEndian, &mask0); err != nil {
+		return cr.n, err
+	}
+	if err := readUint32s(cr, &table.level1); err != nil {
+		return cr.n, err
+	}
+	if err := binary.Read(cr, binary.LittleEndian, &mask1); err != nil {
+		return cr.n, err
+	}
+	if err := readUint64s(cr, &table.Extra); err != nil {
+		return cr.n, err
+	}
+
+	// Tables written before Extra was kept sorted are sorted on read.
+	slices.Sort(table.Extra)
+	table.level0Mask = int(mask0)
+	table.level1Mask = int(mask1)
+	*t = table
+	return cr.n, nil
+}
+
+func readUint64s(r io.Reader, dst *[]uint64) error {
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if n > maxSliceLen {
+		return errTooLarge
+	}
+	*dst = make([]uint64, n)
+	return binary.Read(r, binary.LittleEndian, *dst)
+}
+
+func readUint32s(r io.Reader, dst *[]uint32) error {
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if n > maxSliceLen {
+		return errTooLarge
+	}
+	*dst = make([]uint32, n)
+	return binary.Read(r, binary.LittleEndian, *dst)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -1,7 +1,10 @@
 package mph
 
 import (
+	"slices"
 	"sort"
+
+	"order-food-api/core/couponkey"
 )
 
 const maxSeedAttempts = 1_000_000
@@ -15,13 +18,22 @@ type Table struct {
 	Extra      []uint64
 }
 
-// Build builds the MPH for string keys of max length 10, allowed chars 0-9 A-Z.
+// Build builds the MPH for coupon codes, encoded with couponkey.Encode.
 func Build(keys []string) *Table {
-	encodedKeys := make([]uint64, len(keys))
-	for i, k := range keys {
-		encodedKeys[i] = encodeKey(k)
-	}
-	return buildUint64(encodedKeys)
+	return BuildSorted(couponkey.EncodeAll(keys))
+}
+
+// BuildSorted builds the MPH for keys that are sorted and distinct, e.g. the
+// chunks of a file encoded with couponkey.EncodeAll and merged with
+// couponkey.MergeSorted. Duplicate keys could never be placed without
+// collision and would all end up in Extra.
+func BuildSorted(keys []uint64) *Table {
+	return buildUint64(keys)
+}
+
+// Len returns the number of distinct keys in the table.
+func (t *Table) Len() int {
+	return len(t.keys)
 }
 
 func buildUint64(keys []uint64) *Table {
@@ -30,7 +42,9 @@ func buildUint64(keys []uint64) *Table {
 	}
 
 	level0Size := nextPow2(len(keys) / 8)
-	level1Size := nextPow2(int(float64(len(keys)) * 0.9))
+	// With fewer level 1 slots than keys, buckets that find no free slots
+	// would spill into Extra.
+	level1Size := nextPow2(len(keys) + len(keys)/4)
 
 	level0 := make([]uint32, level0Size)
 	level0Mask := level0Size - 1
@@ -95,6 +109,7 @@ func buildUint64(keys []uint64) *Table {
 		}
 	}
 
+	slices.Sort(extra)
 	return &Table{
 		keys:       keys,
 		level0:     level0,
@@ -107,7 +122,10 @@ func buildUint64(keys []uint64) *Table {
 
 // Lookup returns the index and if key exists.
 func (t *Table) Lookup(key string) (n uint32, ok bool) {
-	k := encodeKey(key)
+	k, ok := couponkey.Encode(key)
+	if !ok || len(t.keys) == 0 {
+		return 0, false
+	}
 	i0 := int(murmurSeed(0).hashUint64(k)) & t.level0Mask
 	seed := t.level0[i0]
 	i1 := int(murmurSeed(seed).hashUint64(k)) & t.level1Mask
@@ -118,43 +136,13 @@ func (t *Table) Lookup(key string) (n uint32, ok bool) {
 	if k == t.keys[int(n)] {
 		return n, true
 	}
-	// fallback check in Extra (linear scan, can optimize with a map or sorted slice if needed)
-	for _, x := range t.Extra {
-		if x == k {
-			return 0, true
-		}
+	// Keys that found no slot are kept sorted in Extra.
+	if _, found := slices.BinarySearch(t.Extra, k); found {
+		return 0, true
 	}
 	return 0, false
 }
 
-// encodeKey encodes up to 10 chars of 0-9A-Z into a uint64.
-func encodeKey(key string) uint64 {
-	var val uint64 = 0
-	n := len(key)
-	if n > 10 {
-		n = 10
-	}
-	for i := 0; i < n; i++ {
-		val <<= 6
-		val |= charToVal(key[i])
-	}
-	// Shift leftover bits if key shorter than 10
-	val <<= 6 * (10 - n)
-	return val
-}
-
-// charToVal maps '0'-'9','A'-'Z' to 0-35.
-func charToVal(c byte) uint64 {
-	switch {
-	case c >= '0' && c <= '9':
-		return uint64(c - '0')
-	case c >= 'A' && c <= 'Z':
-		return uint64(c - 'A' + 10)
-	default:
-		return 0
-	}
-}
-
 type indexBucket struct {
 	n    int
 	vals []int
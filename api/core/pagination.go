@@ -0,0 +1,41 @@
+package core
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PageResponse is a page of a listing. NextCursor is empty on the last page.
+type PageResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+func RespondPage(c *gin.Context, data interface{}, nextCursor string) {
+	c.JSON(http.StatusOK, PageResponse{Data: data, NextCursor: nextCursor})
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor packs the sort key values of the last row of a page into an
+// opaque cursor.
+func EncodeCursor(values ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(values, "\x00")))
+}
+
+// DecodeCursor unpacks a cursor made by EncodeCursor with n values.
+func DecodeCursor(cursor string, n int) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	values := strings.Split(string(raw), "\x00")
+	if len(values) != n {
+		return nil, ErrInvalidCursor
+	}
+	return values, nil
+}
@@ -0,0 +1,216 @@
+// Package pricing computes order totals and applies coupon discounts.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"order-food-api/core/money"
+)
+
+var (
+	ErrCouponNotActive = errors.New("coupon is not active at this time")
+	ErrBelowMinOrder   = errors.New("order total is below the coupon minimum")
+	ErrNoEligibleItems = errors.New("no items in the order are eligible for the coupon")
+)
+
+type Kind string
+
+const (
+	KindPercentage Kind = "percentage"
+	KindFixed      Kind = "fixed"
+)
+
+// Discount is a percentage (in basis points) or a fixed amount taken off the
+// order subtotal.
+type Discount struct {
+	Kind        Kind
+	BasisPoints int64
+	Amount      money.Amount
+}
+
+// ParseDiscount reads "10%" as a percentage and "5.00" as a fixed amount.
+func ParseDiscount(s string) (Discount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Discount{}, nil
+	}
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		a, err := money.Parse(pct)
+		if err != nil || a < 0 || a > money.FromCents(100_00) {
+			return Discount{}, fmt.Errorf("invalid percentage discount %q", s)
+		}
+		return Discount{Kind: KindPercentage, BasisPoints: a.Cents()}, nil
+	}
+	a, err := money.Parse(s)
+	if err != nil || a < 0 {
+		return Discount{}, fmt.Errorf("invalid fixed discount %q", s)
+	}
+	return Discount{Kind: KindFixed, Amount: a}, nil
+}
+
+// Off returns the amount taken off subtotal, never more than the subtotal.
+func (d Discount) Off(subtotal money.Amount) money.Amount {
+	var off money.Amount
+	switch d.Kind {
+	case KindPercentage:
+		off = subtotal.Percent(d.BasisPoints)
+	case KindFixed:
+		off = d.Amount
+	}
+	return min(max(off, 0), subtotal)
+}
+
+// Window is a daily time range, as offsets from midnight in the pricer's
+// location. End before Start wraps past midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseWindow reads a range such as "16:00-19:00".
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid time window %q", s)
+	}
+	start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+	end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+	if err1 != nil || err2 != nil {
+		return Window{}, fmt.Errorf("invalid time window %q", s)
+	}
+	return Window{Start: sinceMidnight(start), End: sinceMidnight(end)}, nil
+}
+
+func (w Window) Contains(t time.Time) bool {
+	at := sinceMidnight(t)
+	if w.Start <= w.End {
+		return at >= w.Start && at < w.End
+	}
+	return at >= w.Start || at < w.End
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// Rule is the discount of a specific coupon code and the conditions under
+// which it applies. Zero values leave a condition open.
+type Rule struct {
+	Code     string
+	Discount Discount
+	// Window restricts the rule to a daily time range.
+	Window   *Window
+	StartsAt time.Time
+	EndsAt   time.Time
+	// MinOrder is the subtotal the order must reach.
+	MinOrder money.Amount
+	// Categories limits the discount to the lines of these categories.
+	Categories []string
+}
+
+// activeAt reports whether the rule's dates and window include at.
+func (r *Rule) activeAt(at time.Time) bool {
+	if r.Window != nil && !r.Window.Contains(at) {
+		return false
+	}
+	if !r.StartsAt.IsZero() && at.Before(r.StartsAt) {
+		return false
+	}
+	return r.EndsAt.IsZero() || at.Before(r.EndsAt)
+}
+
+type Line struct {
+	UnitPrice money.Amount
+	Quantity  int
+	Category  string
+}
+
+type Quote struct {
+	// Lines holds the subtotal of each line, in input order.
+	Lines     []money.Amount
+	Subtotal  money.Amount
+	Discounts money.Amount
+	Total     money.Amount
+}
+
+type Pricer struct {
+	rules    map[string]Rule
+	fallback Discount
+	loc      *time.Location
+}
+
+// New returns a Pricer applying rules to their codes and fallback to any
+// other validated coupon. Windows are evaluated in loc.
+func New(rules []Rule, fallback Discount, loc *time.Location) *Pricer {
+	p := &Pricer{rules: make(map[string]Rule, len(rules)), fallback: fallback, loc: loc}
+	for _, r := range rules {
+		p.rules[r.Code] = r
+	}
+	return p
+}
+
+// Rule returns the configured rule of a validated coupon code, or the
+// fallback discount when it has none.
+func (p *Pricer) Rule(couponCode string) Rule {
+	if rule, ok := p.rules[couponCode]; ok {
+		return rule
+	}
+	return Rule{Code: couponCode, Discount: p.fallback}
+}
+
+// CheckTime reports ErrCouponNotActive when rule does not apply at.
+func (p *Pricer) CheckTime(rule *Rule, at time.Time) error {
+	if !rule.activeAt(at.In(p.loc)) {
+		return ErrCouponNotActive
+	}
+	return nil
+}
+
+// Price totals lines and applies the discount of couponCode, which must
+// already be validated. An empty code applies no discount.
+func (p *Pricer) Price(lines []Line, couponCode string, at time.Time) (Quote, error) {
+	if couponCode == "" {
+		return p.PriceRule(lines, nil, at)
+	}
+	rule := p.Rule(couponCode)
+	return p.PriceRule(lines, &rule, at)
+}
+
+// PriceRule totals lines and applies rule, or no discount when rule is nil.
+func (p *Pricer) PriceRule(lines []Line, rule *Rule, at time.Time) (Quote, error) {
+	q := Quote{Lines: make([]money.Amount, len(lines))}
+	for i, l := range lines {
+		q.Lines[i] = l.UnitPrice.Mul(l.Quantity)
+		q.Subtotal += q.Lines[i]
+	}
+
+	if rule != nil {
+		if err := p.CheckTime(rule, at); err != nil {
+			return Quote{}, err
+		}
+		if q.Subtotal < rule.MinOrder {
+			return Quote{}, ErrBelowMinOrder
+		}
+
+		eligible := q.Subtotal
+		if len(rule.Categories) > 0 {
+			eligible = 0
+			for i, l := range lines {
+				if slices.Contains(rule.Categories, l.Category) {
+					eligible += q.Lines[i]
+				}
+			}
+			if eligible == 0 {
+				return Quote{}, ErrNoEligibleItems
+			}
+		}
+		q.Discounts = rule.Discount.Off(eligible)
+	}
+
+	q.Total = q.Subtotal - q.Discounts
+	return q, nil
+}
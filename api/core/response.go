@@ -9,6 +9,8 @@ import (
 type ErrorResponse struct {
 	Message string      `json:"message"`
 	Error   interface{} `json:"error,omitempty"`
+	// Details lists the rejected fields of an invalid request body.
+	Details []FieldError `json:"details,omitempty"`
 }
 
 type SuccessResponse struct {
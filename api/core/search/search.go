@@ -2,14 +2,25 @@ package search
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 	"sync"
 	"time"
+
+	"order-food-api/core/couponindex"
 )
 
+const Name = "search"
+
 type Loader struct {
 	filePaths []string
+	tracker   couponindex.Tracker
+}
+
+func init() {
+	couponindex.Register(Name, func() couponindex.Index { return New() })
 }
 
 func New() *Loader {
@@ -17,8 +28,24 @@ func New() *Loader {
 }
 
 func (l *Loader) LoadFiles(paths []string) error {
+	l.tracker.Begin(paths)
+
+	var err error
+	for _, path := range paths {
+		var info os.FileInfo
+		info, err = os.Stat(path)
+		if err != nil {
+			l.tracker.EndFile(path, err)
+			err = fmt.Errorf("error loading %s: %w", path, err)
+			break
+		}
+		l.tracker.BeginFile(path, info.Size())
+		l.tracker.EndFile(path, nil)
+	}
+
 	l.filePaths = paths
-	return nil
+	l.tracker.Finish(err)
+	return err
 }
 
 func (l *Loader) AppearsInAtLeastN(str string, n int) bool {
@@ -87,6 +114,22 @@ func (l *Loader) AppearsInAtLeastN(str string, n int) bool {
 	return false
 }
 
+func (l *Loader) Status() couponindex.Status {
+	return l.tracker.Status()
+}
+
+func (l *Loader) Stats() couponindex.Stats {
+	return couponindex.Stats{
+		Backend: Name,
+		Files:   len(l.filePaths),
+	}
+}
+
+func (l *Loader) Close() error {
+	l.filePaths = nil
+	return nil
+}
+
 func searchWithRipgrep(filePath, pattern string) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
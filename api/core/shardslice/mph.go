@@ -1,5 +1,11 @@
 package shardslice
 
+import (
+	"slices"
+
+	"order-food-api/core/couponkey"
+)
+
 const maxSeedAttempts = 1_000_000
 
 type Table struct {
@@ -7,70 +13,40 @@ type Table struct {
 	Extra []uint64
 }
 
-// Build builds the MPH for string keys of max length 10, allowed chars 0-9 A-Z.
+// Build builds the table for coupon codes, encoded with couponkey.Encode.
 func Build(keys []string) *Table {
-	encodedKeys := make([]uint64, len(keys))
-	for i, k := range keys {
-		encodedKeys[i] = encodeKey(k)
-	}
-	return buildUint64(encodedKeys)
+	return BuildSorted(couponkey.EncodeAll(keys))
 }
 
-func buildUint64(keys []uint64) *Table {
+// BuildSorted builds the table for keys that are sorted and distinct, e.g.
+// the chunks of a file encoded with couponkey.EncodeAll and merged with
+// couponkey.MergeSorted. They are kept as they are for binary search.
+func BuildSorted(keys []uint64) *Table {
 	if len(keys) == 0 {
 		return &Table{}
 	}
-
 	return &Table{
 		keys:  keys,
 		Extra: []uint64{},
 	}
 }
 
-func indexOf(slice []uint64, val uint64) int {
-	for i, v := range slice {
-		if v == val {
-			return i
-		}
-	}
-	return -1 // not found
+// Len returns the number of distinct keys in the table.
+func (t *Table) Len() int {
+	return len(t.keys)
 }
 
 // Lookup returns the index and if key exists.
 func (t *Table) Lookup(key string) (n uint32, ok bool) {
-	k := encodeKey(key)
-	if indexOf(t.keys, k) != -1 {
-		return n, true
+	k, ok := couponkey.Encode(key)
+	if !ok {
+		return 0, false
 	}
-	return 0, false
-}
-
-// encodeKey encodes up to 10 chars of 0-9A-Z into a uint64.
-func encodeKey(key string) uint64 {
-	var val uint64 = 0
-	n := len(key)
-	if n > 10 {
-		n = 10
-	}
-	for i := 0; i < n; i++ {
-		val <<= 6
-		val |= charToVal(key[i])
-	}
-	// Shift leftover bits if key shorter than 10
-	val <<= 6 * (10 - n)
-	return val
-}
-
-// charToVal maps '0'-'9','A'-'Z' to 0-35.
-func charToVal(c byte) uint64 {
-	switch {
-	case c >= '0' && c <= '9':
-		return uint64(c - '0')
-	case c >= 'A' && c <= 'Z':
-		return uint64(c - 'A' + 10)
-	default:
-		return 0
+	i, found := slices.BinarySearch(t.keys, k)
+	if !found {
+		return 0, false
 	}
+	return uint32(i), true
 }
 
 type indexBucket struct {
@@ -6,6 +6,8 @@ import (
 	"encoding/hex"
 	"os"
 	"path/filepath"
+
+	"order-food-api/core/couponkey"
 )
 
 const maxSeedAttempts = 1_000_000
@@ -19,9 +21,12 @@ type Table struct {
 
 // Build encodes keys, builds table, saves to disk, and clears memory.
 func Build(keys []string) *Table {
-	encodedKeys := make([]uint64, len(keys))
-	for i, k := range keys {
-		encodedKeys[i] = encodeKey(k)
+	encodedKeys := make([]uint64, 0, len(keys))
+	for _, k := range keys {
+		// Lines that are not coupon codes can never be looked up.
+		if key, ok := couponkey.Encode(k); ok {
+			encodedKeys = append(encodedKeys, key)
+		}
 	}
 	t := buildUint64(encodedKeys)
 	t.Hash = hashKeys(keys)
@@ -53,40 +58,16 @@ func (t *Table) Lookup(key string) (n uint32, ok bool) {
 		}
 	}
 
-	k := encodeKey(key)
+	k, ok := couponkey.Encode(key)
+	if !ok {
+		return 0, false
+	}
 	found := indexOf(t.Keys, k) != -1
 
 	t.Keys = nil // Release after lookup
 	return n, found
 }
 
-// encodeKey encodes a string into a compact uint64.
-func encodeKey(key string) uint64 {
-	var val uint64 = 0
-	n := len(key)
-	if n > 10 {
-		n = 10
-	}
-	for i := 0; i < n; i++ {
-		val <<= 6
-		val |= charToVal(key[i])
-	}
-	val <<= 6 * (10 - n)
-	return val
-}
-
-// charToVal maps '0'-'9','A'-'Z' to 0-35.
-func charToVal(c byte) uint64 {
-	switch {
-	case c >= '0' && c <= '9':
-		return uint64(c - '0')
-	case c >= 'A' && c <= 'Z':
-		return uint64(c - 'A' + 10)
-	default:
-		return 0
-	}
-}
-
 // hashKeys creates a hash from the input key list (used for filename).
 func hashKeys(keys []string) string {
 	h := sha256.New()
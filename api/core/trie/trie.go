@@ -63,3 +63,25 @@ func (t *Trie) Search(s string) bool {
 	}
 	return node.isEnd
 }
+
+// Merge moves every code of the other tries into t and returns t. The other
+// tries share nodes with t afterwards and must not be modified.
+func (t *Trie) Merge(others ...*Trie) *Trie {
+	for _, o := range others {
+		mergeNode(t.root, o.root)
+	}
+	return t
+}
+
+func mergeNode(dst, src *TrieNode) {
+	dst.isEnd = dst.isEnd || src.isEnd
+	for i, child := range src.children {
+		switch {
+		case child == nil:
+		case dst.children[i] == nil:
+			dst.children[i] = child
+		default:
+			mergeNode(dst.children[i], child)
+		}
+	}
+}
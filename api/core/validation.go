@@ -0,0 +1,96 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report fields by their JSON names rather than Go field names.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
+
+// FieldError tells why one field of a request body was rejected. Field is
+// the dotted JSON path of the field, e.g. image.thumbnail.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is a request body rejected field by field.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, f := range e {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// FieldErrors converts the validator errors in err to a ValidationError.
+// It reports false when err does not come from validation.
+func FieldErrors(err error) (ValidationError, bool) {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil, false
+	}
+	fields := make(ValidationError, len(errs))
+	for i, fe := range errs {
+		// Drop the struct name the namespace starts with.
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		fields[i] = FieldError{Field: field, Message: fieldMessage(fe)}
+	}
+	return fields, true
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "oneof":
+		return "must be one of " + fe.Param()
+	case "url", "http_url":
+		return "must be a valid http(s) URL"
+	}
+	return "failed the " + fe.Tag() + " check"
+}
+
+// RespondValidationError answers 422 with the rejected fields in details.
+func RespondValidationError(c *gin.Context, msg string, fields ValidationError) {
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, ErrorResponse{
+		Message: msg,
+		Error:   fields.Error(),
+		Details: fields,
+	})
+}
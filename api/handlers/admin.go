@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"order-food-api/core"
+	"order-food-api/core/couponindex"
+)
+
+const (
+	ErrCouponReloadInProgress = "Coupon reload already in progress"
+	ErrCouponReloadFailed     = "Failed to start coupon reload"
+)
+
+// ReloadCoupons rebuilds the coupon cache from the configured files in the
+// background. The current cache keeps serving until the new one is ready.
+func (h *Handler) ReloadCoupons() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := h.Info.CouponReload.ReloadAsync(h.Info.CouponFiles); err != nil {
+			if errors.Is(err, couponindex.ErrReloadInProgress) {
+				core.RespondError(c, http.StatusConflict, ErrCouponReloadInProgress, nil)
+				return
+			}
+			core.RespondError(c, http.StatusInternalServerError, ErrCouponReloadFailed, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, core.SuccessResponse{Data: h.Info.CouponCache.Status()})
+	}
+}
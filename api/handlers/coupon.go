@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"order-food-api/core"
+	"order-food-api/core/coupon"
+	"order-food-api/core/money"
+	"order-food-api/core/pricing"
+	"order-food-api/models"
+	"order-food-api/models/dto"
+)
+
+const (
+	ErrCouponInvalidInput = "Invalid input"
+	ErrCouponNotFound     = "Coupon not found"
+	ErrCouponDuplicate    = "Coupon code already exists"
+	ErrCouponFailedSave   = "Failed to save coupon"
+	ErrCouponFailedFetch  = "Failed to fetch coupons"
+	ErrCouponFailedDelete = "Failed to delete coupon"
+)
+
+// CheckCoupon reports whether a coupon code would be accepted and which
+// discount it gives, without a cart.
+func (h *Handler) CheckCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.respondCouponCheck(c, c.Param("code"), "", nil)
+	}
+}
+
+// ValidateCoupon checks a coupon against a cart and returns the discount it
+// would give the order.
+func (h *Handler) ValidateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req dto.CouponCheckReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			core.RespondError(c, http.StatusBadRequest, ErrCouponInvalidInput, err)
+			return
+		}
+
+		var lines []pricing.Line
+		if len(req.Items) > 0 {
+			var err error
+			if _, lines, err = h.buildCart(h.DB, req.Items); err != nil {
+				respondCartError(c, err)
+				return
+			}
+		}
+		h.respondCouponCheck(c, req.CouponCode, req.CustomerID, lines)
+	}
+}
+
+// respondCouponCheck answers 200 whether or not the code is accepted, with
+// the reason it is not; only an unavailable cache or a failure is an error.
+func (h *Handler) respondCouponCheck(c *gin.Context, code, customerID string, lines []pricing.Line) {
+	res := dto.CouponCheckRes{Code: h.Info.Coupons.Normalize(code)}
+	err := h.checkCoupon(&res, customerID, lines, time.Now())
+	switch {
+	case err == nil:
+		res.Valid = true
+	case errors.Is(err, coupon.ErrUnavailable):
+		respondCouponError(c, err)
+		return
+	case isCouponRejection(err):
+		res.Reason = err.Error()
+	default:
+		core.RespondError(c, http.StatusInternalServerError, ErrCouponFailedFetch, err)
+		return
+	}
+	core.RespondSuccess(c, res)
+}
+
+// checkCoupon runs the checks of PlaceOrder on res.Code without redeeming
+// it, filling in the discount and, when lines are given, the cart totals.
+func (h *Handler) checkCoupon(res *dto.CouponCheckRes, customerID string, lines []pricing.Line, at time.Time) error {
+	code, err := h.Info.Coupons.Validate(res.Code)
+	if err != nil {
+		return err
+	}
+	if code == "" {
+		return coupon.ErrNotFound
+	}
+
+	campaign, err := findCampaign(h.DB, code)
+	if err != nil {
+		return err
+	}
+	rule := h.Info.Pricing.Rule(code)
+	if campaign != nil {
+		if !campaign.Active {
+			return pricing.ErrCouponNotActive
+		}
+		if err := h.checkUsage(campaign, customerID); err != nil {
+			return err
+		}
+		rule = campaign.Rule()
+	}
+
+	res.Discount = &dto.CouponDiscount{Type: rule.Discount.Kind, Value: rule.Discount.Amount}
+	if rule.Discount.Kind == pricing.KindPercentage {
+		res.Discount.Value = money.FromCents(rule.Discount.BasisPoints)
+	}
+
+	if lines == nil {
+		return h.Info.Pricing.CheckTime(&rule, at)
+	}
+	quote, err := h.Info.Pricing.PriceRule(lines, &rule, at)
+	if err != nil {
+		return err
+	}
+	res.Subtotal, res.Discounts, res.Total = &quote.Subtotal, &quote.Discounts, &quote.Total
+	return nil
+}
+
+// checkUsage reports whether the campaign's usage limits are already
+// reached. Unlike redeemCoupon it takes no lock, so a concurrent order may
+// still use the last redemption.
+func (h *Handler) checkUsage(campaign *models.Coupon, customerID string) error {
+	if campaign.MaxRedemptions > 0 && campaign.Redemptions >= campaign.MaxRedemptions {
+		return coupon.ErrExhausted
+	}
+	if campaign.MaxPerCustomer == 0 || customerID == "" {
+		return nil
+	}
+
+	var used int64
+	err := h.DB.Model(&models.CouponRedemption{}).
+		Where("coupon_id = ? AND customer_id = ? AND released_at IS NULL", campaign.ID, customerID).
+		Count(&used).Error
+	if err != nil {
+		return err
+	}
+	if used >= int64(campaign.MaxPerCustomer) {
+		return coupon.ErrCustomerLimit
+	}
+	return nil
+}
+
+// isCouponRejection reports whether err is a reason for not accepting a
+// coupon rather than a failure to check it.
+func isCouponRejection(err error) bool {
+	for _, target := range []error{
+		coupon.ErrTooShort, coupon.ErrTooLong, coupon.ErrBadCharset,
+		coupon.ErrNotFound, coupon.ErrSingleFile,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return isPricingRejection(err) || isRedemptionRejection(err)
+}
+
+func (h *Handler) ListCoupons() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupons []models.Coupon
+		if err := h.DB.Order("code").Find(&coupons).Error; err != nil {
+			core.RespondError(c, http.StatusInternalServerError, ErrCouponFailedFetch, err)
+			return
+		}
+		core.RespondSuccess(c, coupons)
+	}
+}
+
+func (h *Handler) GetCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupon models.Coupon
+		if err := h.DB.First(&coupon, "id = ?", c.Param("couponId")).Error; err != nil {
+			core.RespondError(c, http.StatusNotFound, ErrCouponNotFound, err)
+			return
+		}
+		core.RespondSuccess(c, coupon)
+	}
+}
+
+func (h *Handler) CreateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupon models.Coupon
+		if !h.bindCoupon(c, &coupon) {
+			return
+		}
+		coupon.ID = 0
+		coupon.Redemptions = 0
+
+		if err := h.DB.Create(&coupon).Error; err != nil {
+			respondCouponSaveError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, core.SuccessResponse{Data: coupon})
+	}
+}
+
+// UpdateCoupon replaces the campaign with the request body.
+func (h *Handler) UpdateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var existing models.Coupon
+		if err := h.DB.First(&existing, "id = ?", c.Param("couponId")).Error; err != nil {
+			core.RespondError(c, http.StatusNotFound, ErrCouponNotFound, err)
+			return
+		}
+
+		var coupon models.Coupon
+		if !h.bindCoupon(c, &coupon) {
+			return
+		}
+		coupon.ID = existing.ID
+		coupon.CreatedAt = existing.CreatedAt
+		coupon.Redemptions = existing.Redemptions
+
+		if err := h.DB.Omit("redemptions").Save(&coupon).Error; err != nil {
+			respondCouponSaveError(c, err)
+			return
+		}
+		core.RespondSuccess(c, coupon)
+	}
+}
+
+func (h *Handler) DeleteCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res := h.DB.Delete(&models.Coupon{}, "id = ?", c.Param("couponId"))
+		if res.Error != nil {
+			core.RespondError(c, http.StatusInternalServerError, ErrCouponFailedDelete, res.Error)
+			return
+		}
+		if res.RowsAffected == 0 {
+			core.RespondError(c, http.StatusNotFound, ErrCouponNotFound, nil)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// bindCoupon binds and validates a campaign, normalizing its code the way
+// order coupon codes are normalized.
+func (h *Handler) bindCoupon(c *gin.Context, coupon *models.Coupon) bool {
+	if err := c.ShouldBindJSON(coupon); err != nil {
+		core.RespondError(c, http.StatusBadRequest, ErrCouponInvalidInput, err)
+		return false
+	}
+	coupon.Code = h.Info.Coupons.Normalize(coupon.Code)
+	if err := coupon.Validate(); err != nil {
+		core.RespondError(c, http.StatusUnprocessableEntity, ErrCouponInvalidInput, err)
+		return false
+	}
+	return true
+}
+
+func respondCouponSaveError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		core.RespondError(c, http.StatusConflict, ErrCouponDuplicate, nil)
+		return
+	}
+	core.RespondError(c, http.StatusInternalServerError, ErrCouponFailedSave, err)
+}
+
+// findCampaign returns the campaign of a validated coupon code: the one
+// with exactly that code, else the most specific matching pattern. It
+// returns nil when no campaign applies.
+func findCampaign(db *gorm.DB, code string) (*models.Coupon, error) {
+	var exact models.Coupon
+	err := db.Where("code = ?", code).Take(&exact).Error
+	if err == nil {
+		return &exact, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var patterns []models.Coupon
+	if err := db.Where("code LIKE ? OR code LIKE ? OR code LIKE ?", "%*%", "%?%", "%[%").Find(&patterns).Error; err != nil {
+		return nil, err
+	}
+	var best *models.Coupon
+	for i := range patterns {
+		p := &patterns[i]
+		if p.Matches(code) && (best == nil || len(p.Code) > len(best.Code)) {
+			best = p
+		}
+	}
+	return best, nil
+}
+
+// redeemCoupon records the use of the order's coupon within tx. The usage
+// cap is enforced by a conditional update of the campaign, which also locks
+// its row until tx ends, so concurrent orders redeeming the same campaign
+// are serialized. The per-customer count is a locking read: a plain read
+// would see the snapshot taken by the first read of tx, and miss a
+// redemption committed while tx waited for the campaign row.
+func redeemCoupon(tx *gorm.DB, campaign *models.Coupon, order *models.Order) error {
+	redemption := models.CouponRedemption{
+		CouponCode: order.CouponCode,
+		CustomerID: order.CustomerID,
+		OrderID:    order.ID,
+		Discount:   order.Discounts,
+	}
+
+	if campaign != nil {
+		redemption.CouponID = &campaign.ID
+		if campaign.MaxPerCustomer > 0 && order.CustomerID == "" {
+			return coupon.ErrCustomerRequired
+		}
+
+		res := tx.Model(&models.Coupon{}).
+			Where("id = ? AND (max_redemptions = 0 OR redemptions < max_redemptions)", campaign.ID).
+			UpdateColumn("redemptions", gorm.Expr("redemptions + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return coupon.ErrExhausted
+		}
+
+		if campaign.MaxPerCustomer > 0 {
+			var used int64
+			err := tx.Model(&models.CouponRedemption{}).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("coupon_id = ? AND customer_id = ? AND released_at IS NULL", campaign.ID, order.CustomerID).
+				Count(&used).Error
+			if err != nil {
+				return err
+			}
+			if used >= int64(campaign.MaxPerCustomer) {
+				return coupon.ErrCustomerLimit
+			}
+		}
+	}
+
+	return tx.Create(&redemption).Error
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"order-food-api/core/coupon"
+	"order-food-api/core/couponindex"
+	"order-food-api/core/money"
+	"order-food-api/core/pricing"
+	"order-food-api/internal/testdb"
+	"order-food-api/models"
+)
+
+// foundEverywhere is a coupon cache that finds every code in every file.
+type foundEverywhere struct{}
+
+func (foundEverywhere) AppearsInAtLeastN(code string, n int) bool { return true }
+func (foundEverywhere) Status() couponindex.Status {
+	return couponindex.Status{State: couponindex.StateReady}
+}
+
+// newCouponTest stores a product and a campaign for a fresh code, removed
+// with everything ordered with them when the test ends.
+func newCouponTest(t *testing.T, db *gorm.DB, campaign models.Coupon) (*gin.Engine, models.Product, models.Coupon) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	product := models.Product{Name: "Race Waffle", Price: money.FromCents(1000), Category: "Waffle"}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	campaign.Code = fmt.Sprintf("RACE%06d", time.Now().UnixNano()%1_000_000)
+	campaign.DiscountType = pricing.KindFixed
+	campaign.DiscountValue = money.FromCents(100)
+	campaign.Active = true
+	if err := db.Create(&campaign).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		var orderIDs []string
+		db.Model(&models.Order{}).Where("coupon_code = ?", campaign.Code).Pluck("id", &orderIDs)
+		db.Where("coupon_code = ?", campaign.Code).Delete(&models.CouponRedemption{})
+		db.Where("order_id IN ?", append(orderIDs, "")).Delete(&models.OrderItem{})
+		db.Where("order_id IN ?", append(orderIDs, "")).Delete(&models.OrderStatusChange{})
+		db.Where("coupon_code = ?", campaign.Code).Delete(&models.Order{})
+		db.Delete(&campaign)
+		db.Unscoped().Delete(&product)
+	})
+
+	coupons, err := coupon.NewValidator(foundEverywhere{}, coupon.DefaultRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(WithDB(db), WithInfo(InfoOption{
+		Coupons:     coupons,
+		Pricing:     pricing.New(nil, pricing.Discount{}, time.UTC),
+		MaxQuantity: 10,
+	}))
+	r := gin.New()
+	r.POST("/order", h.PlaceOrder())
+	return r, product, campaign
+}
+
+// placeParallel places n identical orders at once and returns how many got
+// each status code.
+func placeParallel(t *testing.T, r *gin.Engine, n int, body map[string]interface{}) map[int]int {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		statuses = make(map[int]int)
+		start    = make(chan struct{})
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/order", bytes.NewReader(payload)))
+			mu.Lock()
+			statuses[w.Code]++
+			mu.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return statuses
+}
+
+func TestRedeemOneUseCouponInParallel(t *testing.T) {
+	db := testdb.Open(t)
+	r, product, campaign := newCouponTest(t, db, models.Coupon{MaxRedemptions: 1})
+
+	statuses := placeParallel(t, r, 10, map[string]interface{}{
+		"couponCode": campaign.Code,
+		"items":      []map[string]interface{}{{"productId": strconv.Itoa(int(product.ID)), "quantity": 1}},
+	})
+
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusUnprocessableEntity] != 9 {
+		t.Fatalf("statuses = %v, want one 200 and nine 422", statuses)
+	}
+	var redemptions int64
+	db.Model(&models.CouponRedemption{}).Where("coupon_code = ?", campaign.Code).Count(&redemptions)
+	if redemptions != 1 {
+		t.Fatalf("%d redemptions recorded, want 1", redemptions)
+	}
+}
+
+func TestRedeemPerCustomerLimitInParallel(t *testing.T) {
+	db := testdb.Open(t)
+	r, product, campaign := newCouponTest(t, db, models.Coupon{MaxPerCustomer: 1})
+
+	statuses := placeParallel(t, r, 10, map[string]interface{}{
+		"customerId": "race-customer",
+		"couponCode": campaign.Code,
+		"items":      []map[string]interface{}{{"productId": strconv.Itoa(int(product.ID)), "quantity": 1}},
+	})
+
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusUnprocessableEntity] != 9 {
+		t.Fatalf("statuses = %v, want one 200 and nine 422", statuses)
+	}
+}
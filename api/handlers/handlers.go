@@ -2,15 +2,32 @@ package handlers
 
 import (
 	"gorm.io/gorm"
+
+	"order-food-api/core/coupon"
+	"order-food-api/core/couponindex"
+	"order-food-api/core/pricing"
 )
 
 type Cache interface {
 	AppearsInAtLeastN(code string, n int) bool
+	Status() couponindex.Status
+}
+
+type Reloader interface {
+	ReloadAsync(files []string) error
 }
 
 type InfoOption struct {
-	BasePath    string
-	CouponCache Cache
+	BasePath     string
+	CouponCache  Cache
+	Coupons      *coupon.Validator
+	Pricing      *pricing.Pricer
+	CouponReload Reloader
+	CouponFiles  []string
+	// MaxQuantity is the largest quantity of a single product per order.
+	MaxQuantity int
+	// Categories are the allowed product categories; empty allows any.
+	Categories []string
 }
 
 type Option func(*Handler)
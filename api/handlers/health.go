@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"order-food-api/core/couponindex"
+)
+
+// Healthz reports that the process is up, along with the coupon cache state
+// and, for probabilistic backends, the estimated rate of accepted coupons
+// that are not actually valid.
+func (h *Handler) Healthz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := gin.H{
+			"status": "ok",
+			"coupon": h.Info.CouponCache.Status(),
+		}
+		if e, ok := h.Info.CouponCache.(couponindex.Estimator); ok {
+			body["couponFalsePositiveRate"] = e.FalsePositiveRate(h.Info.Coupons.Rules().MinFiles)
+		}
+		c.JSON(http.StatusOK, body)
+	}
+}
+
+// Readyz reports whether the server can fully serve orders, which requires
+// the coupon cache to be loaded.
+func (h *Handler) Readyz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := h.Info.CouponCache.Status()
+		if !status.Ready() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status": "unavailable",
+				"coupon": status,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ok",
+			"coupon": status,
+		})
+	}
+}
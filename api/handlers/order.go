@@ -1,24 +1,49 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
 	"order-food-api/core"
+	"order-food-api/core/coupon"
+	"order-food-api/core/pricing"
 	"order-food-api/models"
 	"order-food-api/models/dto"
+	"order-food-api/services"
 )
 
 const (
 	ErrOrderInvalidInput       = "Invalid input"
-	ErrOrderInvalidProductID   = "Invalid product ID"
+	ErrOrderUnknownProducts    = "Unknown products"
+	ErrOrderInvalidQuantity    = "Invalid quantity"
 	ErrOrderFailedCreateOrder  = "Failed to create order"
 	ErrOrderFailedFetchProduct = "Failed to fetch products"
+	ErrOrderCouponUnavailable  = "Coupon validation unavailable"
+	ErrOrderInvalidCoupon      = "Invalid coupon code"
+	ErrOrderCouponRejected     = "Coupon code not accepted"
+	ErrOrderNotFound           = "Order not found"
+	ErrOrderFailedFetch        = "Failed to fetch orders"
+	ErrOrderFailedUpdate       = "Failed to update order"
+	ErrOrderIllegalTransition  = "Order status change not allowed"
 )
 
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+// couponRetryAfter is the Retry-After hint, in seconds, sent while the
+// coupon cache is still loading.
+const couponRetryAfter = "30"
+
 func (h *Handler) PlaceOrder() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req dto.OrderReq
@@ -27,45 +52,363 @@ func (h *Handler) PlaceOrder() gin.HandlerFunc {
 			return
 		}
 
-		// Verify coupon by cache
-		if !h.Info.CouponCache.AppearsInAtLeastN(req.CouponCode, 2) {
-			core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, nil)
+		couponCode, err := h.Info.Coupons.Validate(req.CouponCode)
+		if err != nil {
+			respondCouponError(c, err)
 			return
 		}
 
-		orderID := uuid.NewString()
 		order := models.Order{
-			ID:         orderID,
-			CouponCode: req.CouponCode,
+			ID:         uuid.NewString(),
+			Status:     models.OrderStatusPlaced,
+			Version:    1,
+			CustomerID: req.CustomerID,
+			CouponCode: couponCode,
 		}
 
-		var productIDs []int
+		// Products, campaign and redemption are read and written in one
+		// transaction, so the order is only stored when all of them agree.
+		err = h.DB.Transaction(func(tx *gorm.DB) error {
+			items, lines, err := h.buildCart(tx, req.Items)
+			if err != nil {
+				return err
+			}
 
-		for _, item := range req.Items {
-			productIDInt, err := strconv.Atoi(item.ProductID)
+			quote, campaign, err := h.priceOrder(tx, lines, couponCode, time.Now())
 			if err != nil {
-				core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidProductID, err)
+				return err
+			}
+			order.Items = items
+			order.Total = quote.Total
+			order.Discounts = quote.Discounts
+
+			if couponCode != "" {
+				if err := redeemCoupon(tx, campaign, &order); err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(&order).Error; err != nil {
+				return err
+			}
+			return services.RecordStatus(tx, order.ID, "", order.Status, "")
+		})
+		if err != nil {
+			respondOrderError(c, err)
+			return
+		}
+
+		order.Products = order.SnapshotProducts()
+		c.Header("ETag", orderETag(&order))
+		core.RespondSuccess(c, order)
+	}
+}
+
+// GetOrder returns an order with its items and their current products.
+func (h *Handler) GetOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var order models.Order
+		err := h.DB.Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+			Preload("Items.Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+			Preload("History", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+			Preload("Refund").
+			First(&order, "id = ?", c.Param("orderId")).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				core.RespondError(c, http.StatusNotFound, ErrOrderNotFound, nil)
 				return
 			}
-			order.Items = append(order.Items, models.OrderItem{
-				ProductID: models.ProductID(productIDInt),
-				Quantity:  item.Quantity,
-			})
-			productIDs = append(productIDs, productIDInt)
+			core.RespondError(c, http.StatusInternalServerError, ErrOrderFailedFetch, err)
+			return
+		}
+
+		order.Products = order.SnapshotProducts()
+		c.Header("ETag", orderETag(&order))
+		core.RespondSuccess(c, order)
+	}
+}
+
+// UpdateOrderStatus moves an order along its lifecycle, answering 409 for
+// a change the lifecycle does not allow.
+func (h *Handler) UpdateOrderStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req dto.OrderStatusReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, err)
+			return
 		}
 
-		if err := h.DB.Create(&order).Error; err != nil {
-			core.RespondError(c, http.StatusInternalServerError, ErrOrderFailedCreateOrder, err)
+		order, err := services.UpdateOrderStatus(h.DB, c.Param("orderId"), req.Status, req.Note)
+		if err != nil {
+			respondOrderStatusError(c, err)
 			return
 		}
+		core.RespondSuccess(c, order)
+	}
+}
 
-		var products []models.Product
-		if err := h.DB.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
-			core.RespondError(c, http.StatusInternalServerError, ErrOrderFailedFetchProduct, err)
+// CancelOrder cancels an order that is not yet ready, releasing its coupon
+// and creating its refund.
+func (h *Handler) CancelOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req dto.CancelOrderReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, err)
 			return
 		}
 
-		order.Products = products
+		order, err := services.CancelOrder(h.DB, c.Param("orderId"), req.Reason)
+		if err != nil {
+			respondOrderStatusError(c, err)
+			return
+		}
 		core.RespondSuccess(c, order)
 	}
 }
+
+func respondOrderStatusError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		core.RespondError(c, http.StatusNotFound, ErrOrderNotFound, nil)
+	case errors.Is(err, services.ErrUnknownStatus):
+		core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, err)
+	case errors.Is(err, services.ErrIllegalTransition):
+		core.RespondError(c, http.StatusConflict, ErrOrderIllegalTransition, err)
+	default:
+		core.RespondError(c, http.StatusInternalServerError, ErrOrderFailedUpdate, err)
+	}
+}
+
+// ListOrders returns orders newest first, a page at a time. The query can
+// filter by creation time (from inclusive, to exclusive, RFC 3339), coupon
+// code and status; cursor is the nextCursor of the previous page.
+func (h *Handler) ListOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := defaultOrderPageSize
+		if s := c.Query("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxOrderPageSize {
+				core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput,
+					fmt.Errorf("limit must be between 1 and %d", maxOrderPageSize))
+				return
+			}
+			limit = n
+		}
+
+		query := h.DB.Model(&models.Order{})
+		for param, cond := range map[string]string{"from": "created_at >= ?", "to": "created_at < ?"} {
+			if s := c.Query(param); s != "" {
+				t, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, fmt.Errorf("%s: %w", param, err))
+					return
+				}
+				query = query.Where(cond, t)
+			}
+		}
+		if s := c.Query("couponCode"); s != "" {
+			query = query.Where("coupon_code = ?", h.Info.Coupons.Normalize(s))
+		}
+		if s := c.Query("status"); s != "" {
+			query = query.Where("status = ?", s)
+		}
+		if s := c.Query("cursor"); s != "" {
+			values, err := core.DecodeCursor(s, 2)
+			if err != nil {
+				core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, err)
+				return
+			}
+			createdAt, err := time.Parse(time.RFC3339Nano, values[0])
+			if err != nil {
+				core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, core.ErrInvalidCursor)
+				return
+			}
+			query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", createdAt, createdAt, values[1])
+		}
+
+		var orders []models.Order
+		err := query.Order("created_at DESC, id DESC").Limit(limit+1).
+			Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+			Preload("Items.Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+			Find(&orders).Error
+		if err != nil {
+			core.RespondError(c, http.StatusInternalServerError, ErrOrderFailedFetch, err)
+			return
+		}
+
+		next := ""
+		if len(orders) > limit {
+			orders = orders[:limit]
+			last := orders[limit-1]
+			next = core.EncodeCursor(last.CreatedAt.Format(time.RFC3339Nano), last.ID)
+		}
+		for i := range orders {
+			orders[i].Products = orders[i].SnapshotProducts()
+		}
+		core.RespondPage(c, orders, next)
+	}
+}
+
+var (
+	errUnknownProducts = errors.New("unknown product IDs")
+	errInvalidQuantity = errors.New("invalid quantity")
+)
+
+// buildCart resolves the requested items to order items, snapshotting their
+// products, and to pricing lines. Items of the same product are merged, in
+// the order they first appear.
+func (h *Handler) buildCart(db *gorm.DB, reqItems []dto.OrderItemReq) ([]models.OrderItem, []pricing.Line, error) {
+	var (
+		items   []models.OrderItem
+		index   = make(map[models.ProductID]int, len(reqItems))
+		unknown []string
+	)
+	for _, item := range reqItems {
+		id, err := strconv.Atoi(item.ProductID)
+		if err != nil || id <= 0 {
+			unknown = append(unknown, item.ProductID)
+			continue
+		}
+		// Both the line and the running total are checked against the limit,
+		// so merging lines can never overflow.
+		productID := models.ProductID(id)
+		if err := h.checkQuantity(productID, item.Quantity); err != nil {
+			return nil, nil, err
+		}
+		if i, ok := index[productID]; ok {
+			items[i].Quantity += item.Quantity
+			if err := h.checkQuantity(productID, items[i].Quantity); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		index[productID] = len(items)
+		items = append(items, models.OrderItem{ProductID: productID, Quantity: item.Quantity})
+	}
+
+	productIDs := make([]models.ProductID, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+	}
+
+	var products []models.Product
+	if len(productIDs) > 0 {
+		if err := db.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	byID := make(map[models.ProductID]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+	lines := make([]pricing.Line, len(items))
+	for i, item := range items {
+		product, ok := byID[item.ProductID]
+		if !ok {
+			unknown = append(unknown, strconv.Itoa(int(item.ProductID)))
+			continue
+		}
+		items[i].Name = product.Name
+		items[i].Category = product.Category
+		items[i].UnitPrice = product.Price
+		items[i].LineTotal = product.Price.Mul(item.Quantity)
+		lines[i] = pricing.Line{UnitPrice: product.Price, Quantity: item.Quantity, Category: product.Category}
+	}
+	if len(unknown) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s", errUnknownProducts, strings.Join(unknown, ", "))
+	}
+	return items, lines, nil
+}
+
+// checkQuantity rejects a quantity of a single product outside 1 to
+// MaxQuantity.
+func (h *Handler) checkQuantity(productID models.ProductID, quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("%w: product %d has quantity %d", errInvalidQuantity, productID, quantity)
+	}
+	if quantity > h.Info.MaxQuantity {
+		return fmt.Errorf("%w: product %d has quantity %d, at most %d allowed",
+			errInvalidQuantity, productID, quantity, h.Info.MaxQuantity)
+	}
+	return nil
+}
+
+// respondCartError answers a buildCart error.
+func respondCartError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUnknownProducts):
+		core.RespondError(c, http.StatusUnprocessableEntity, ErrOrderUnknownProducts, err)
+	case errors.Is(err, errInvalidQuantity):
+		core.RespondError(c, http.StatusUnprocessableEntity, ErrOrderInvalidQuantity, err)
+	default:
+		core.RespondError(c, http.StatusInternalServerError, ErrOrderFailedFetchProduct, err)
+	}
+}
+
+// respondOrderError answers an error of the order placement transaction.
+func respondOrderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUnknownProducts), errors.Is(err, errInvalidQuantity):
+		respondCartError(c, err)
+	case isPricingRejection(err), isRedemptionRejection(err):
+		core.RespondError(c, http.StatusUnprocessableEntity, ErrOrderCouponRejected, err)
+	default:
+		core.RespondError(c, http.StatusInternalServerError, ErrOrderFailedCreateOrder, err)
+	}
+}
+
+// respondCouponError maps a coupon validation error to its response: a
+// malformed code is a bad request, a well-formed code that is not a valid
+// coupon cannot be processed, and an unloaded cache is temporary.
+func respondCouponError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, coupon.ErrUnavailable):
+		c.Header("Retry-After", couponRetryAfter)
+		core.RespondError(c, http.StatusServiceUnavailable, ErrOrderCouponUnavailable, nil)
+	case errors.Is(err, coupon.ErrNotFound), errors.Is(err, coupon.ErrSingleFile):
+		core.RespondError(c, http.StatusUnprocessableEntity, ErrOrderCouponRejected, err)
+	default:
+		core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidCoupon, err)
+	}
+}
+
+// priceOrder prices lines with the campaign of couponCode when it has one,
+// and with the configured coupon rules otherwise. The campaign is nil when
+// none applies.
+func (h *Handler) priceOrder(db *gorm.DB, lines []pricing.Line, couponCode string, at time.Time) (pricing.Quote, *models.Coupon, error) {
+	if couponCode == "" {
+		quote, err := h.Info.Pricing.Price(lines, "", at)
+		return quote, nil, err
+	}
+
+	campaign, err := findCampaign(db, couponCode)
+	if err != nil {
+		return pricing.Quote{}, nil, err
+	}
+	if campaign == nil {
+		quote, err := h.Info.Pricing.Price(lines, couponCode, at)
+		return quote, nil, err
+	}
+	if !campaign.Active {
+		return pricing.Quote{}, nil, pricing.ErrCouponNotActive
+	}
+	rule := campaign.Rule()
+	quote, err := h.Info.Pricing.PriceRule(lines, &rule, at)
+	return quote, campaign, err
+}
+
+// isPricingRejection reports whether err means the coupon does not apply to
+// the order, as opposed to a failure to price it.
+func isPricingRejection(err error) bool {
+	return errors.Is(err, pricing.ErrCouponNotActive) ||
+		errors.Is(err, pricing.ErrBelowMinOrder) ||
+		errors.Is(err, pricing.ErrNoEligibleItems)
+}
+
+// isRedemptionRejection reports whether err means the coupon's usage limits
+// are reached.
+func isRedemptionRejection(err error) bool {
+	return errors.Is(err, coupon.ErrExhausted) ||
+		errors.Is(err, coupon.ErrCustomerLimit) ||
+		errors.Is(err, coupon.ErrCustomerRequired)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"order-food-api/core"
+	"order-food-api/core/pricing"
+	"order-food-api/models"
+	"order-food-api/models/dto"
+	"order-food-api/services"
+)
+
+const (
+	ErrOrderNotEditable       = "Order can no longer be modified"
+	ErrOrderVersionMismatch   = "Order was modified by another request"
+	ErrOrderVersionRequired   = "If-Match header or version is required"
+	ErrOrderUnknownOrderItem  = "Product is not in the order"
+	ErrOrderFailedUpdateItems = "Failed to update order items"
+)
+
+var (
+	errOrderNotEditable  = errors.New("order is not editable")
+	errVersionMismatch   = errors.New("order version mismatch")
+	errUnknownOrderItem  = errors.New("product is not in the order")
+	errOrderWouldBeEmpty = errors.New("order must keep at least one item")
+)
+
+// UpdateOrderItems adds, removes or changes the quantity of items of an
+// order that is still placed, then validates the products and reprices the
+// order with its coupon again, as placing it would. Items already in the
+// order keep the price they were ordered at. The request must name
+// the order version it is based on, by If-Match or in the body; a stale
+// version is answered with 412.
+func (h *Handler) UpdateOrderItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req dto.OrderItemsPatchReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, err)
+			return
+		}
+
+		version := req.Version
+		if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+			v, err := parseOrderETag(ifMatch)
+			if err != nil {
+				core.RespondError(c, http.StatusBadRequest, ErrOrderInvalidInput, err)
+				return
+			}
+			version = v
+		}
+		if version <= 0 {
+			core.RespondError(c, http.StatusPreconditionRequired, ErrOrderVersionRequired, nil)
+			return
+		}
+
+		var order *models.Order
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if order, err = services.LockOrder(tx, c.Param("orderId")); err != nil {
+				return err
+			}
+			if order.Version != version {
+				return errVersionMismatch
+			}
+			if order.Status != models.OrderStatusPlaced {
+				return fmt.Errorf("%w: order is %s", errOrderNotEditable, order.Status)
+			}
+			if err := tx.Where("order_id = ?", order.ID).Order("id").Find(&order.Items).Error; err != nil {
+				return err
+			}
+
+			reqItems, err := applyItemOps(order.Items, req.Operations)
+			if err != nil {
+				return err
+			}
+			return h.repriceOrder(tx, order, reqItems)
+		})
+		if err != nil {
+			respondOrderItemsError(c, err)
+			return
+		}
+
+		order.Products = order.SnapshotProducts()
+		c.Header("ETag", orderETag(order))
+		core.RespondSuccess(c, order)
+	}
+}
+
+// applyItemOps applies the operations to the current items and returns the
+// resulting cart.
+func applyItemOps(items []models.OrderItem, ops []dto.OrderItemOp) ([]dto.OrderItemReq, error) {
+	cart := make([]dto.OrderItemReq, len(items))
+	for i, item := range items {
+		cart[i] = dto.OrderItemReq{ProductID: strconv.Itoa(int(item.ProductID)), Quantity: item.Quantity}
+	}
+	find := func(productID string) int {
+		for i, item := range cart {
+			if item.ProductID == strings.TrimSpace(productID) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, op := range ops {
+		i := find(op.ProductID)
+		switch op.Op {
+		case dto.OrderItemAdd:
+			if i < 0 {
+				cart = append(cart, dto.OrderItemReq{ProductID: strings.TrimSpace(op.ProductID), Quantity: op.Quantity})
+				continue
+			}
+			cart[i].Quantity += op.Quantity
+		case dto.OrderItemSet:
+			if i < 0 {
+				return nil, fmt.Errorf("%w: %s", errUnknownOrderItem, op.ProductID)
+			}
+			cart[i].Quantity = op.Quantity
+		case dto.OrderItemRemove:
+			if i < 0 {
+				return nil, fmt.Errorf("%w: %s", errUnknownOrderItem, op.ProductID)
+			}
+			cart = append(cart[:i], cart[i+1:]...)
+		}
+	}
+
+	if len(cart) == 0 {
+		return nil, errOrderWouldBeEmpty
+	}
+	return cart, nil
+}
+
+// repriceOrder replaces the items of a locked order with reqItems and
+// prices them with the order's coupon as of when it was placed, then bumps
+// its version. Lines already in the order keep the name, category and price
+// they were ordered with; only added products are snapshotted.
+func (h *Handler) repriceOrder(tx *gorm.DB, order *models.Order, reqItems []dto.OrderItemReq) error {
+	stored := make(map[string]models.OrderItem, len(order.Items))
+	for _, item := range order.Items {
+		stored[strconv.Itoa(int(item.ProductID))] = item
+	}
+	var addedReqs []dto.OrderItemReq
+	for _, item := range reqItems {
+		if _, ok := stored[item.ProductID]; !ok {
+			addedReqs = append(addedReqs, item)
+		}
+	}
+	added, _, err := h.buildCart(tx, addedReqs)
+	if err != nil {
+		return err
+	}
+
+	items := make([]models.OrderItem, 0, len(reqItems))
+	for _, item := range reqItems {
+		kept, ok := stored[item.ProductID]
+		if !ok {
+			continue
+		}
+		if err := h.checkQuantity(kept.ProductID, item.Quantity); err != nil {
+			return err
+		}
+		items = append(items, models.OrderItem{
+			ProductID: kept.ProductID,
+			Quantity:  item.Quantity,
+			Name:      kept.Name,
+			Category:  kept.Category,
+			UnitPrice: kept.UnitPrice,
+			LineTotal: kept.UnitPrice.Mul(item.Quantity),
+		})
+	}
+	items = append(items, added...)
+
+	lines := make([]pricing.Line, len(items))
+	for i, item := range items {
+		lines[i] = pricing.Line{UnitPrice: item.UnitPrice, Quantity: item.Quantity, Category: item.Category}
+	}
+	quote, _, err := h.priceOrder(tx, lines, order.CouponCode, order.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Where("order_id = ?", order.ID).Delete(&models.OrderItem{}).Error; err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].OrderID = order.ID
+	}
+	if err := tx.Create(&items).Error; err != nil {
+		return err
+	}
+
+	res := tx.Model(&models.Order{}).Where("id = ? AND version = ?", order.ID, order.Version).Updates(map[string]any{
+		"total":     quote.Total,
+		"discounts": quote.Discounts,
+		"version":   gorm.Expr("version + 1"),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errVersionMismatch
+	}
+	if order.CouponCode != "" {
+		err := tx.Model(&models.CouponRedemption{}).
+			Where("order_id = ? AND released_at IS NULL", order.ID).
+			Update("discount", quote.Discounts).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	order.Items = items
+	order.Total = quote.Total
+	order.Discounts = quote.Discounts
+	order.Version++
+	return nil
+}
+
+func respondOrderItemsError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		core.RespondError(c, http.StatusNotFound, ErrOrderNotFound, nil)
+	case errors.Is(err, errVersionMismatch):
+		core.RespondError(c, http.StatusPreconditionFailed, ErrOrderVersionMismatch, nil)
+	case errors.Is(err, errOrderNotEditable):
+		core.RespondError(c, http.StatusConflict, ErrOrderNotEditable, err)
+	case errors.Is(err, errUnknownOrderItem):
+		core.RespondError(c, http.StatusUnprocessableEntity, ErrOrderUnknownOrderItem, err)
+	case errors.Is(err, errOrderWouldBeEmpty):
+		core.RespondError(c, http.StatusUnprocessableEntity, ErrOrderInvalidInput, err)
+	case errors.Is(err, errUnknownProducts), errors.Is(err, errInvalidQuantity),
+		isPricingRejection(err), isRedemptionRejection(err):
+		respondOrderError(c, err)
+	default:
+		core.RespondError(c, http.StatusInternalServerError, ErrOrderFailedUpdateItems, err)
+	}
+}
+
+func orderETag(order *models.Order) string {
+	return strconv.Quote(strconv.Itoa(order.Version))
+}
+
+// parseOrderETag reads the version of an If-Match value made by orderETag.
+func parseOrderETag(etag string) (int, error) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	v, err := strconv.Atoi(strings.Trim(etag, `"`))
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid If-Match %q", etag)
+	}
+	return v, nil
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"order-food-api/core/money"
+	"order-food-api/core/pricing"
+	"order-food-api/internal/testdb"
+	"order-food-api/models"
+)
+
+func TestUpdateOrderItemsKeepsStoredPrices(t *testing.T) {
+	db := testdb.Open(t)
+	gin.SetMode(gin.TestMode)
+
+	kept := models.Product{Name: "Snapshot Waffle", Price: money.FromCents(1000), Category: "Waffle"}
+	added := models.Product{Name: "Snapshot Tart", Price: money.FromCents(500), Category: "Tart"}
+	if err := db.Create(&[]*models.Product{&kept, &added}).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := models.Order{
+		ID:      uuid.NewString(),
+		Status:  models.OrderStatusPlaced,
+		Version: 1,
+		Total:   money.FromCents(1000),
+		Items: []models.OrderItem{{
+			ProductID: kept.ID,
+			Quantity:  1,
+			Name:      kept.Name,
+			Category:  kept.Category,
+			UnitPrice: kept.Price,
+			LineTotal: kept.Price,
+		}},
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Where("order_id = ?", order.ID).Delete(&models.OrderItem{})
+		db.Delete(&order)
+		db.Unscoped().Delete(&[]models.Product{kept, added})
+	})
+	if err := db.Model(&kept).Update("price", money.FromCents(2000)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(WithDB(db), WithInfo(InfoOption{
+		Pricing:     pricing.New(nil, pricing.Discount{}, time.UTC),
+		MaxQuantity: 10,
+	}))
+	r := gin.New()
+	r.PATCH("/order/:orderId/items", h.UpdateOrderItems())
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"version": 1,
+		"operations": []map[string]interface{}{
+			{"op": "set", "productId": strconv.Itoa(int(kept.ID)), "quantity": 2},
+			{"op": "add", "productId": strconv.Itoa(int(added.ID)), "quantity": 1},
+		},
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/order/"+order.ID+"/items", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	var res struct {
+		Data models.Order `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Data.Items[0].UnitPrice; got != money.FromCents(1000) {
+		t.Errorf("kept line unit price = %s, want the stored 10.00", got)
+	}
+	if got := res.Data.Items[1].UnitPrice; got != money.FromCents(500) {
+		t.Errorf("added line unit price = %s, want the current 5.00", got)
+	}
+	if got := res.Data.Total; got != money.FromCents(2500) {
+		t.Errorf("total = %s, want 25.00", got)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"order-food-api/models/dto"
+)
+
+func TestBuildCartRejectsOverflowingQuantities(t *testing.T) {
+	h := NewHandler(WithInfo(InfoOption{MaxQuantity: 10}))
+
+	tests := []struct {
+		name  string
+		items []dto.OrderItemReq
+	}{
+		{"overflowing lines", []dto.OrderItemReq{
+			{ProductID: "1", Quantity: math.MaxInt},
+			{ProductID: "1", Quantity: math.MaxInt},
+		}},
+		{"line above the limit", []dto.OrderItemReq{{ProductID: "1", Quantity: 11}}},
+		{"merged lines above the limit", []dto.OrderItemReq{
+			{ProductID: "1", Quantity: 6},
+			{ProductID: "1", Quantity: 5},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The quantities are rejected before the products are looked up,
+			// so no database is needed.
+			_, _, err := h.buildCart(nil, tt.items)
+			if !errors.Is(err, errInvalidQuantity) {
+				t.Fatalf("buildCart() error = %v, want %v", err, errInvalidQuantity)
+			}
+		})
+	}
+}
@@ -1,27 +1,144 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"order-food-api/core"
+	"order-food-api/core/money"
 	"order-food-api/models"
+	"order-food-api/models/dto"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
 )
 
 const (
 	ErrProductInvalidInput = "Invalid input"
 	ErrProductNotFound     = "Product not found"
 	ErrProductCreate       = "Failed to create product"
+	ErrProductFailedFetch  = "Failed to fetch products"
+	ErrProductUpdate       = "Failed to update product"
+	ErrProductDelete       = "Failed to delete product"
 )
 
+const (
+	defaultProductPageSize = 100
+	maxProductPageSize     = 500
+
+	// NextCursorHeader carries the cursor of the next page of a listing
+	// that answers with a plain array.
+	NextCursorHeader = "X-Next-Cursor"
+)
+
+// productSorts maps the sort parameter to its column and direction.
+var productSorts = map[string]struct {
+	column string
+	desc   bool
+}{
+	"id":     {"id", false},
+	"price":  {"price", false},
+	"-price": {"price", true},
+	"name":   {"name", false},
+	"-name":  {"name", true},
+}
+
+// ListProducts returns products a page at a time, filtered by category,
+// price range (minPrice, maxPrice) and name substring (q), sorted by id,
+// price or name (prefixed with - for descending). The cursor of the next
+// page is sent in the X-Next-Cursor header.
 func (h *Handler) ListProducts() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		limit := defaultProductPageSize
+		if s := c.Query("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxProductPageSize {
+				core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput,
+					fmt.Errorf("limit must be between 1 and %d", maxProductPageSize))
+				return
+			}
+			limit = n
+		}
+
+		sortName := c.DefaultQuery("sort", "id")
+		sort, ok := productSorts[sortName]
+		if !ok {
+			core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput,
+				fmt.Errorf("sort must be one of id, price, -price, name, -name"))
+			return
+		}
+
+		query := h.DB.Model(&models.Product{})
+		if s := c.Query("category"); s != "" {
+			query = query.Where("category = ?", s)
+		}
+		for param, cond := range map[string]string{"minPrice": "price >= ?", "maxPrice": "price <= ?"} {
+			if s := c.Query(param); s != "" {
+				price, err := money.Parse(s)
+				if err != nil {
+					core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput, fmt.Errorf("%s: %w", param, err))
+					return
+				}
+				query = query.Where(cond, price)
+			}
+		}
+		if s := c.Query("q"); s != "" {
+			query = query.Where("name LIKE ?", "%"+escapeLike(s)+"%")
+		}
+
+		op, dir := ">", "ASC"
+		if sort.desc {
+			op, dir = "<", "DESC"
+		}
+		if s := c.Query("cursor"); s != "" {
+			values, err := core.DecodeCursor(s, 3)
+			if err != nil || values[0] != sortName {
+				core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput, core.ErrInvalidCursor)
+				return
+			}
+			if sort.column == "id" {
+				query = query.Where("id > ?", values[2])
+			} else {
+				query = query.Where(fmt.Sprintf("%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?)", sort.column, op),
+					values[1], values[1], values[2])
+			}
+		}
+		if sort.column != "id" {
+			query = query.Order(sort.column + " " + dir)
+		}
+		query = query.Order("id " + dir)
+
 		var products []models.Product
-		h.DB.Find(&products)
+		if err := query.Limit(limit + 1).Find(&products).Error; err != nil {
+			core.RespondError(c, http.StatusInternalServerError, ErrProductFailedFetch, err)
+			return
+		}
+
+		if len(products) > limit {
+			products = products[:limit]
+			last := products[limit-1]
+			var value string
+			switch sort.column {
+			case "price":
+				value = last.Price.String()
+			case "name":
+				value = last.Name
+			}
+			c.Header(NextCursorHeader, core.EncodeCursor(sortName, value, strconv.Itoa(int(last.ID))))
+		}
 		c.JSON(http.StatusOK, products)
 	}
 }
 
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func (h *Handler) GetProduct() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("productId")
@@ -36,11 +153,15 @@ func (h *Handler) GetProduct() gin.HandlerFunc {
 
 func (h *Handler) CreateProduct() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var product models.Product
-		if err := c.ShouldBindJSON(&product); err != nil {
+		body, err := c.GetRawData()
+		if err != nil {
 			core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput, err)
 			return
 		}
+		product, ok := h.bindProduct(c, body)
+		if !ok {
+			return
+		}
 
 		if err := h.DB.Create(&product).Error; err != nil {
 			core.RespondError(c, http.StatusInternalServerError, ErrProductCreate, err)
@@ -50,3 +171,168 @@ func (h *Handler) CreateProduct() gin.HandlerFunc {
 		c.JSON(http.StatusCreated, product)
 	}
 }
+
+// UpdateProduct replaces a product with the request body.
+func (h *Handler) UpdateProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		existing, ok := h.findProduct(c)
+		if !ok {
+			return
+		}
+
+		body, err := c.GetRawData()
+		if err != nil {
+			core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput, err)
+			return
+		}
+		product, ok := h.bindProduct(c, body)
+		if !ok {
+			return
+		}
+		h.saveProduct(c, existing, product)
+	}
+}
+
+// PatchProduct applies a JSON merge patch (RFC 7396) to a product. Image
+// fields are merged individually; null removes a field.
+func (h *Handler) PatchProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		existing, ok := h.findProduct(c)
+		if !ok {
+			return
+		}
+
+		patch, err := c.GetRawData()
+		if err != nil {
+			core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput, err)
+			return
+		}
+		doc, err := json.Marshal(existing)
+		if err != nil {
+			core.RespondError(c, http.StatusInternalServerError, ErrProductUpdate, err)
+			return
+		}
+		merged, err := core.MergePatch(doc, patch)
+		if err != nil {
+			core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput, err)
+			return
+		}
+		// The patched product is validated as a whole, like a PUT body.
+		product, ok := h.bindProduct(c, merged)
+		if !ok {
+			return
+		}
+		h.saveProduct(c, existing, product)
+	}
+}
+
+// DeleteProduct soft-deletes a product.
+func (h *Handler) DeleteProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res := h.DB.Delete(&models.Product{}, "id = ?", c.Param("productId"))
+		if res.Error != nil {
+			core.RespondError(c, http.StatusInternalServerError, ErrProductDelete, res.Error)
+			return
+		}
+		if res.RowsAffected == 0 {
+			core.RespondError(c, http.StatusNotFound, ErrProductNotFound, nil)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// bindProduct decodes and validates a product body. Malformed JSON is
+// answered with 400; a well-formed body with invalid fields with 422 and
+// the rejected fields in details.
+func (h *Handler) bindProduct(c *gin.Context, body []byte) (models.Product, bool) {
+	var input dto.ProductInput
+	if err := json.Unmarshal(body, &input); err != nil {
+		if errors.Is(err, money.ErrInvalidAmount) {
+			core.RespondValidationError(c, ErrProductInvalidInput, core.ValidationError{
+				{Field: "price", Message: "must be an amount with at most 2 decimals"},
+			})
+			return models.Product{}, false
+		}
+		core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput, err)
+		return models.Product{}, false
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	input.Category = strings.TrimSpace(input.Category)
+
+	var fields core.ValidationError
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		var ok bool
+		if fields, ok = core.FieldErrors(err); !ok {
+			core.RespondError(c, http.StatusBadRequest, ErrProductInvalidInput, err)
+			return models.Product{}, false
+		}
+	}
+	if input.Category != "" {
+		category, ok := h.productCategory(input.Category)
+		if !ok {
+			fields = append(fields, core.FieldError{
+				Field:   "category",
+				Message: "must be one of " + strings.Join(h.Info.Categories, ", "),
+			})
+		}
+		input.Category = category
+	}
+	if len(fields) > 0 {
+		core.RespondValidationError(c, ErrProductInvalidInput, fields)
+		return models.Product{}, false
+	}
+
+	return models.Product{
+		Name:     input.Name,
+		Price:    input.Price,
+		Category: input.Category,
+		Image: models.Image{
+			Thumbnail: input.Image.Thumbnail,
+			Mobile:    input.Image.Mobile,
+			Tablet:    input.Image.Tablet,
+			Desktop:   input.Image.Desktop,
+		},
+	}, true
+}
+
+// productCategory returns the configured spelling of an allowed category,
+// matched case-insensitively.
+func (h *Handler) productCategory(category string) (string, bool) {
+	if len(h.Info.Categories) == 0 {
+		return category, true
+	}
+	for _, c := range h.Info.Categories {
+		if strings.EqualFold(c, category) {
+			return c, true
+		}
+	}
+	return category, false
+}
+
+func (h *Handler) findProduct(c *gin.Context) (models.Product, bool) {
+	var product models.Product
+	err := h.DB.First(&product, "id = ?", c.Param("productId")).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			core.RespondError(c, http.StatusNotFound, ErrProductNotFound, nil)
+		} else {
+			core.RespondError(c, http.StatusInternalServerError, ErrProductFailedFetch, err)
+		}
+		return product, false
+	}
+	return product, true
+}
+
+// saveProduct stores product in place of existing, keeping its ID.
+func (h *Handler) saveProduct(c *gin.Context, existing, product models.Product) {
+	product.ID = existing.ID
+	// Unlike Save, Updates never inserts, so a product deleted meanwhile
+	// stays deleted.
+	err := h.DB.Model(&product).Select("*").Omit("id", "deleted_at").Updates(&product).Error
+	if err != nil {
+		core.RespondError(c, http.StatusInternalServerError, ErrProductUpdate, err)
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
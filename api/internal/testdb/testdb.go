@@ -0,0 +1,67 @@
+// Package testdb connects tests to the MySQL database they need.
+package testdb
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"order-food-api/models"
+)
+
+// DSNEnv names the environment variable holding the test database DSN, e.g.
+// root:secret@tcp(localhost:3306)/orderdb?parseTime=True with the db service
+// of docker-compose.
+const DSNEnv = "TEST_DATABASE_DSN"
+
+var (
+	once sync.Once
+	db   *gorm.DB
+	err  error
+)
+
+// Open returns the database in DSNEnv with every model migrated, and skips
+// the test when it is not set.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skip(DSNEnv + " not set")
+	}
+	once.Do(func() { db, err = open(dsn) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func open(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// go test runs packages in parallel; a named lock keeps their
+	// migrations from creating the same table at once.
+	err = db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT GET_LOCK('order_food_api_test_migrate', 60)").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK('order_food_api_test_migrate')")
+		return conn.AutoMigrate(
+			&models.Product{}, &models.Order{}, &models.OrderItem{}, &models.OrderStatusChange{}, &models.Refund{},
+			&models.Coupon{}, &models.CouponRedemption{}, &models.IdempotencyKey{},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -2,28 +2,38 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"slices"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
-	cache "order-food-api/core/cacheBloomFilter"
-	// cache "order-food-api/core/cacheSlicePersist"
-	// cache "order-food-api/core/cacheSlice"
-	// cache "order-food-api/core/cacheMap"
-	// cache "order-food-api/core/cacheMPH"
-
-	// cache "order-food-api/core/cacheBitmap"
-	// cache "order-food-api/core/search"
-	// cache "order-food-api/core/cacheTrie"
+	_ "order-food-api/core/cacheBitmap"
+	_ "order-food-api/core/cacheBloomFilter"
+	_ "order-food-api/core/cacheExact"
+	_ "order-food-api/core/cacheMPH"
+	_ "order-food-api/core/cacheMap"
+	_ "order-food-api/core/cacheSlice"
+	_ "order-food-api/core/cacheSlicePersist"
+	_ "order-food-api/core/cacheTrie"
+	_ "order-food-api/core/search"
 
+	"order-food-api/core/cachePrepared"
 	"order-food-api/core/config"
+	"order-food-api/core/coupon"
+	"order-food-api/core/couponindex"
 	"order-food-api/core/database"
+	"order-food-api/core/pricing"
 	"order-food-api/handlers"
 	"order-food-api/middleware"
 	"order-food-api/models"
+	"order-food-api/services"
 )
 
 func main() {
@@ -34,29 +44,157 @@ func main() {
 		panic("Failed to get absolute path of program: " + err.Error())
 	}
 
-	files := []string{"./files/couponbase1.gz", "./files/couponbase2.gz", "./files/couponbase3.gz"}
-	couponCache := cache.New()
-	go func() {
-		couponCache.LoadFiles(files)
-	}()
-
 	cfg := config.LoadConfig(filepath.Join(absPath, "config.ini"))
+
+	couponCache, err := couponindex.NewReloader(cfg.Coupon.Backend, func(idx couponindex.Index, files []string) error {
+		return couponindex.Load(idx, files, cfg.Coupon.SnapshotDir)
+	})
+	if err != nil {
+		log.Fatalf("Failed to create coupon cache: %v", err)
+	}
+	defer couponCache.Close()
+
+	// The verify file is reopened with every reload, and watched with the
+	// coupon files, so that regenerating it after the files changed takes
+	// effect. A reload refuses a verify file older than the coupon files and
+	// keeps serving the previous index until it is regenerated.
+	watched := cfg.Coupon.Files
+	if cfg.Coupon.VerifyFile != "" {
+		couponCache.VerifyWith(func() (couponindex.Verifier, error) {
+			return cachePrepared.OpenFresh(cfg.Coupon.VerifyFile, cfg.Coupon.Files)
+		})
+		watched = append(slices.Clip(watched), cfg.Coupon.VerifyFile)
+	}
+	couponCache.ReloadAsync(cfg.Coupon.Files)
+	go reloadCouponsOnChange(couponCache, cfg.Coupon.Files, watched, cfg.Coupon.WatchInterval)
+
+	var couponLookup handlers.Cache = couponCache
+
+	rules := coupon.DefaultRules()
+	rules.Case = cfg.Coupon.Case
+	coupons, err := coupon.NewValidator(couponLookup, rules)
+	if err != nil {
+		log.Fatalf("Failed to create coupon validator: %v", err)
+	}
+
+	pricer, err := newPricer(cfg.Pricing)
+	if err != nil {
+		log.Fatalf("Failed to configure pricing: %v", err)
+	}
+
 	db := database.Connect(cfg.Database)
-	db.AutoMigrate(&models.Product{}, &models.Order{}, &models.OrderItem{})
+	db.AutoMigrate(
+		&models.Product{}, &models.Order{}, &models.OrderItem{}, &models.OrderStatusChange{}, &models.Refund{},
+		&models.Coupon{}, &models.CouponRedemption{}, &models.IdempotencyKey{},
+	)
+	backfilled, err := services.BackfillItemSnapshots(db)
+	if err != nil {
+		log.Fatalf("Failed to backfill order item snapshots: %v", err)
+	}
+	if backfilled > 0 {
+		log.Printf("Backfilled the product snapshot of %d order items", backfilled)
+	}
 
 	r := gin.Default()
+	if err := r.SetTrustedProxies(cfg.App.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+	handle := handlers.NewHandler(handlers.WithDB(db), handlers.WithInfo(handlers.InfoOption{
+		BasePath:     absPath,
+		CouponCache:  couponLookup,
+		Coupons:      coupons,
+		Pricing:      pricer,
+		CouponReload: couponCache,
+		CouponFiles:  cfg.Coupon.Files,
+		MaxQuantity:  cfg.Order.MaxQuantity,
+		Categories:   cfg.Product.Categories,
+	}))
+	r.GET("/healthz", handle.Healthz())
+	r.GET("/readyz", handle.Readyz())
+
+	couponCheckLimit := middleware.RateLimit(cfg.Coupon.CheckPerMinute, cfg.Coupon.CheckBurst)
+
 	api := r.Group("/api")
 	{
-		handle := handlers.NewHandler(handlers.WithDB(db), handlers.WithInfo(handlers.InfoOption{BasePath: absPath, CouponCache: couponCache}))
 		api.GET("/product", handle.ListProducts())
 		api.GET("/product/:productId", handle.GetProduct())
 		api.POST("/product", middleware.APIKeyAuth(), handle.CreateProduct())
-		api.POST("/order", middleware.APIKeyAuth(), handle.PlaceOrder())
+		api.PUT("/product/:productId", middleware.APIKeyAuth(), handle.UpdateProduct())
+		api.PATCH("/product/:productId", middleware.APIKeyAuth(), handle.PatchProduct())
+		api.DELETE("/product/:productId", middleware.APIKeyAuth(), handle.DeleteProduct())
+		api.POST("/order", middleware.APIKeyAuth(), middleware.Idempotency(db, cfg.Order.IdempotencyTTL), handle.PlaceOrder())
+		api.GET("/order", middleware.APIKeyAuth(), handle.ListOrders())
+		api.GET("/order/:orderId", middleware.APIKeyAuth(), handle.GetOrder())
+		api.PATCH("/order/:orderId/status", middleware.APIKeyAuth(), handle.UpdateOrderStatus())
+		api.POST("/order/:orderId/cancel", middleware.APIKeyAuth(), handle.CancelOrder())
+		api.PATCH("/order/:orderId/items", middleware.APIKeyAuth(), handle.UpdateOrderItems())
+		api.GET("/coupon/:code", couponCheckLimit, handle.CheckCoupon())
+		api.POST("/coupon/validate", couponCheckLimit, handle.ValidateCoupon())
+		api.POST("/admin/coupon/reload", middleware.APIKeyAuth(), handle.ReloadCoupons())
+		api.GET("/admin/coupon", middleware.APIKeyAuth(), handle.ListCoupons())
+		api.POST("/admin/coupon", middleware.APIKeyAuth(), handle.CreateCoupon())
+		api.GET("/admin/coupon/:couponId", middleware.APIKeyAuth(), handle.GetCoupon())
+		api.PUT("/admin/coupon/:couponId", middleware.APIKeyAuth(), handle.UpdateCoupon())
+		api.DELETE("/admin/coupon/:couponId", middleware.APIKeyAuth(), handle.DeleteCoupon())
 	}
 
 	r.Run(":" + cfg.App.Port)
 }
 
+// reloadCouponsOnChange rebuilds the coupon cache on SIGHUP and, when
+// interval is set, whenever the coupon files change on disk.
+func reloadCouponsOnChange(cache *couponindex.Reloader, files, watched []string, interval time.Duration) {
+	reload := func(reason string) bool {
+		if err := cache.ReloadAsync(files); err != nil {
+			log.Printf("Coupon reload skipped (%s): %v", reason, err)
+			return false
+		}
+		log.Printf("Reloading coupon cache: %s", reason)
+		return true
+	}
+
+	// A change seen while a reload is running is retried by Watch until it
+	// is picked up.
+	if interval > 0 {
+		go couponindex.Watch(watched, interval, func() bool { return reload("files changed") })
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		reload("SIGHUP")
+	}
+}
+
+// newPricer builds the discount rules of the well-known coupons from cfg.
+func newPricer(cfg config.PricingConfig) (*pricing.Pricer, error) {
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := pricing.ParseDiscount(cfg.DefaultDiscount)
+	if err != nil {
+		return nil, err
+	}
+	happyHours, err := pricing.ParseWindow(cfg.HappyHours)
+	if err != nil {
+		return nil, err
+	}
+	happyHoursDiscount, err := pricing.ParseDiscount(cfg.HappyHoursDiscount)
+	if err != nil {
+		return nil, err
+	}
+	fiftyOff, err := pricing.ParseDiscount(cfg.FiftyOffDiscount)
+	if err != nil {
+		return nil, err
+	}
+
+	return pricing.New([]pricing.Rule{
+		{Code: "HAPPYHRS", Discount: happyHoursDiscount, Window: &happyHours},
+		{Code: "FIFTYOFF", Discount: fiftyOff},
+	}, fallback, loc), nil
+}
+
 func showServerStats() {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"order-food-api/models"
+)
+
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyLease is how long a key stays claimed by a request still in
+// progress. A claim older than that is taken as abandoned by a process that
+// died mid-request, and the key can be claimed again.
+const idempotencyLease = 2 * time.Minute
+
+// Idempotency makes requests carrying an Idempotency-Key header safe to
+// retry for ttl. The first request with a key is handled and its response
+// stored; a retry with the same key and body gets the stored response, with
+// a different body 422, and while the first is still running 409. Responses
+// with a 5xx status, or from a handler that panicked, are not stored, so the
+// request can be retried.
+func Idempotency(db *gorm.DB, ttl time.Duration) gin.HandlerFunc {
+	var (
+		sweepMu sync.Mutex
+		swept   time.Time
+	)
+	sweep := func(now time.Time) {
+		sweepMu.Lock()
+		defer sweepMu.Unlock()
+		if now.Sub(swept) < time.Minute {
+			return
+		}
+		swept = now
+		db.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{})
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 191 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": IdempotencyHeader + " is too long"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := hashRequest(c.Request.Method, c.FullPath(), body)
+
+		now := time.Now()
+		sweep(now)
+		record := models.IdempotencyKey{Key: key, RequestHash: requestHash, ExpiresAt: now.Add(ttl)}
+		err = db.Create(&record).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// An expired key or an abandoned claim is free again; a
+			// concurrent request may claim it first, in which case this one
+			// sees its record below.
+			db.Where("`key` = ? AND (expires_at < ? OR (status = 0 AND created_at < ?))", key, now, now.Add(-idempotencyLease)).
+				Delete(&models.IdempotencyKey{})
+			err = db.Create(&record).Error
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			replayIdempotent(c, db, key, requestHash)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store idempotency key"})
+			c.Abort()
+			return
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			// A panic unwinds through here to the recovery middleware
+			// without a response to store: free the key for a retry.
+			if !completed {
+				db.Delete(&models.IdempotencyKey{}, "`key` = ?", key)
+			}
+		}()
+		c.Next()
+		completed = true
+
+		if status := writer.Status(); status >= http.StatusInternalServerError {
+			db.Delete(&models.IdempotencyKey{}, "`key` = ?", key)
+		} else {
+			db.Model(&models.IdempotencyKey{}).Where("`key` = ?", key).
+				Updates(map[string]any{"status": status, "body": writer.body.Bytes()})
+		}
+	}
+}
+
+// hashRequest identifies a request: a retry must hit the same route with the
+// same body.
+func hashRequest(method, route string, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, method+" "+route+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayIdempotent answers a request whose key is already stored.
+func replayIdempotent(c *gin.Context, db *gorm.DB, key, requestHash string) {
+	var record models.IdempotencyKey
+	if err := db.First(&record, "`key` = ?", key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load idempotency key"})
+		c.Abort()
+		return
+	}
+
+	switch {
+	case record.RequestHash != requestHash:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": IdempotencyHeader + " was already used with a different request"})
+	case record.Status == 0:
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this " + IdempotencyHeader + " is still in progress"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(record.Status, "application/json; charset=utf-8", record.Body)
+	}
+	c.Abort()
+}
+
+// capturingWriter keeps a copy of the response body.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"order-food-api/internal/testdb"
+	"order-food-api/models"
+)
+
+func idempotentRequest(r *gin.Engine, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"n":1}`))
+	req.Header.Set(IdempotencyHeader, key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyFreesKeyAfterPanic(t *testing.T) {
+	db := testdb.Open(t)
+	key := fmt.Sprintf("panic-%d", time.Now().UnixNano())
+	t.Cleanup(func() { db.Delete(&models.IdempotencyKey{}, "`key` = ?", key) })
+
+	gin.SetMode(gin.TestMode)
+	panics := true
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, err any) { c.AbortWithStatus(http.StatusInternalServerError) }))
+	r.POST("/", Idempotency(db, time.Hour), func(c *gin.Context) {
+		if panics {
+			panic("handler failed")
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	if w := idempotentRequest(r, key); w.Code != http.StatusInternalServerError {
+		t.Fatalf("first request: %d, want 500", w.Code)
+	}
+	panics = false
+	if w := idempotentRequest(r, key); w.Code != http.StatusOK {
+		t.Fatalf("retry after a panic: %d, want 200", w.Code)
+	}
+	if w := idempotentRequest(r, key); w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("second retry was not replayed: %d", w.Code)
+	}
+}
+
+func TestIdempotencyReclaimsAbandonedKey(t *testing.T) {
+	db := testdb.Open(t)
+	key := fmt.Sprintf("abandoned-%d", time.Now().UnixNano())
+	t.Cleanup(func() { db.Delete(&models.IdempotencyKey{}, "`key` = ?", key) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/", Idempotency(db, time.Hour), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	// A claim left by a request that never finished.
+	now := time.Now()
+	claim := models.IdempotencyKey{
+		Key:         key,
+		RequestHash: hashRequest(http.MethodPost, "/", []byte(`{"n":1}`)),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+	if err := db.Create(&claim).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := idempotentRequest(r, key); w.Code != http.StatusConflict {
+		t.Fatalf("request during a live claim: %d, want 409", w.Code)
+	}
+
+	db.Model(&claim).Update("created_at", now.Add(-idempotencyLease-time.Minute))
+	if w := idempotentRequest(r, key); w.Code != http.StatusOK {
+		t.Fatalf("request after the lease: %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBuckets bounds the clients tracked at once. Once reached, requests of
+// new clients are refused until buckets refill and are swept.
+const maxBuckets = 100_000
+
+// RateLimit allows each client IP perMinute requests on average, with bursts
+// of up to burst requests, and answers 429 beyond that. A perMinute of 0
+// disables the limit.
+//
+// The client IP is gin's ClientIP, so the engine's trusted proxies must be
+// set (see gin.Engine.SetTrustedProxies): otherwise any client can pick its
+// own IP with X-Forwarded-For. IPv6 clients are limited per /64, the block
+// usually given to a single host.
+func RateLimit(perMinute float64, burst int) gin.HandlerFunc {
+	if perMinute <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	limiter := newIPLimiter(perMinute/60, float64(burst))
+	return func(c *gin.Context) {
+		if wait := limiter.take(clientKey(c.ClientIP()), time.Now()); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientKey is the rate limit key of ip: the address itself, or its /64
+// for IPv6.
+func clientKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Unmap().Is4() {
+		return ip
+	}
+	prefix, err := addr.Prefix(64)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// ipLimiter is a token bucket per client IP.
+type ipLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+	max     int
+}
+
+func newIPLimiter(rate, burst float64) *ipLimiter {
+	return &ipLimiter{rate: rate, burst: burst, buckets: make(map[string]*bucket), max: maxBuckets}
+}
+
+// take consumes a token of ip and returns 0, or how long until one is
+// available.
+func (l *ipLimiter) take(ip string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now, time.Minute)
+	b, ok := l.buckets[ip]
+	if !ok {
+		if len(l.buckets) >= l.max {
+			l.sweep(now, time.Second)
+			if len(l.buckets) >= l.max {
+				return time.Second
+			}
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// sweep forgets, at most once per interval, the buckets that have
+// refilled, as they are equivalent to new ones.
+func (l *ipLimiter) sweep(now time.Time, interval time.Duration) {
+	if now.Sub(l.swept) < interval {
+		return
+	}
+	l.swept = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, ip)
+		}
+	}
+}
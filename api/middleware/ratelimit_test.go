@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRateLimitIgnoresForgedForwardedFor checks that rotating
+// X-Forwarded-For does not give a client fresh buckets when no proxy is
+// trusted.
+func TestRateLimitIgnoresForgedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatal(err)
+	}
+	r.GET("/", RateLimit(60, 2), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	codes := make([]int, 4)
+	for i := range codes {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("10.0.0.%d", i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes[i] = w.Code
+	}
+	if codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests || codes[3] != http.StatusTooManyRequests {
+		t.Fatalf("status codes = %v, want the burst of 2 then 429", codes)
+	}
+}
+
+func TestClientKeyGroupsIPv6By64(t *testing.T) {
+	if a, b := clientKey("2001:db8::1"), clientKey("2001:db8::ffff:1"); a != b {
+		t.Fatalf("clientKey gave %s and %s for the same /64", a, b)
+	}
+	if got := clientKey("192.0.2.1"); got != "192.0.2.1" {
+		t.Fatalf("clientKey(192.0.2.1) = %s", got)
+	}
+}
+
+func TestIPLimiterBoundsBuckets(t *testing.T) {
+	l := newIPLimiter(1, 1)
+	l.max = 2
+	now := time.Now()
+
+	l.take("a", now)
+	l.take("b", now)
+	if wait := l.take("c", now); wait == 0 {
+		t.Fatal("a new client was tracked beyond the bucket limit")
+	}
+	if len(l.buckets) != 2 {
+		t.Fatalf("%d buckets, want 2", len(l.buckets))
+	}
+
+	// Once a and b have refilled, they are swept to make room.
+	if wait := l.take("c", now.Add(2*time.Second)); wait != 0 {
+		t.Fatalf("take after refill waited %v", wait)
+	}
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"order-food-api/core/money"
+	"order-food-api/core/pricing"
+)
+
+// Coupon is a campaign attaching a discount and its conditions to a coupon
+// code, or to every code matching a pattern such as "HAPPY*". A code still
+// has to pass the coupon file check before its campaign applies.
+type Coupon struct {
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	Code          string       `json:"code" gorm:"size:32;uniqueIndex"`
+	DiscountType  pricing.Kind `json:"discountType" gorm:"size:16"`
+	DiscountValue money.Amount `json:"discountValue"`
+	StartsAt      *time.Time   `json:"startsAt,omitempty"`
+	EndsAt        *time.Time   `json:"endsAt,omitempty"`
+	MinOrder      money.Amount `json:"minOrder"`
+	Categories    StringList   `json:"categories,omitempty"`
+	// MaxRedemptions and MaxPerCustomer cap the uses of the coupon overall
+	// and per customer. 0 is unlimited.
+	MaxRedemptions int `json:"maxRedemptions"`
+	MaxPerCustomer int `json:"maxPerCustomer"`
+	// Redemptions counts the orders that used the coupon. It is only
+	// changed when an order redeems the coupon.
+	Redemptions int       `json:"redemptions" gorm:"not null;default:0"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// IsPattern reports whether Code is a pattern rather than a single code.
+func (c *Coupon) IsPattern() bool {
+	return strings.ContainsAny(c.Code, "*?[")
+}
+
+func (c *Coupon) Matches(code string) bool {
+	if !c.IsPattern() {
+		return c.Code == code
+	}
+	ok, _ := path.Match(c.Code, code)
+	return ok
+}
+
+func (c *Coupon) Validate() error {
+	if c.Code == "" {
+		return errors.New("code is required")
+	}
+	if _, err := path.Match(c.Code, ""); err != nil {
+		return fmt.Errorf("invalid code pattern %q", c.Code)
+	}
+	switch c.DiscountType {
+	case pricing.KindPercentage:
+		if c.DiscountValue <= 0 || c.DiscountValue > money.FromCents(100_00) {
+			return errors.New("percentage discount must be greater than 0 and at most 100")
+		}
+	case pricing.KindFixed:
+		if c.DiscountValue <= 0 {
+			return errors.New("fixed discount must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("discountType must be %q or %q", pricing.KindPercentage, pricing.KindFixed)
+	}
+	if c.StartsAt != nil && c.EndsAt != nil && !c.EndsAt.After(*c.StartsAt) {
+		return errors.New("endsAt must be after startsAt")
+	}
+	if c.MinOrder < 0 || c.MaxRedemptions < 0 || c.MaxPerCustomer < 0 {
+		return errors.New("minOrder and usage limits must not be negative")
+	}
+	return nil
+}
+
+// Rule returns the pricing rule of the campaign.
+func (c *Coupon) Rule() pricing.Rule {
+	r := pricing.Rule{
+		Code:       c.Code,
+		MinOrder:   c.MinOrder,
+		Categories: c.Categories,
+	}
+	switch c.DiscountType {
+	case pricing.KindPercentage:
+		r.Discount = pricing.Discount{Kind: pricing.KindPercentage, BasisPoints: c.DiscountValue.Cents()}
+	case pricing.KindFixed:
+		r.Discount = pricing.Discount{Kind: pricing.KindFixed, Amount: c.DiscountValue}
+	}
+	if c.StartsAt != nil {
+		r.StartsAt = *c.StartsAt
+	}
+	if c.EndsAt != nil {
+		r.EndsAt = *c.EndsAt
+	}
+	return r
+}
+
+// CouponRedemption records the use of a coupon by an order. CouponID is
+// set when the code has a campaign. ReleasedAt is set when the order is
+// cancelled and the use no longer counts against the campaign limits.
+type CouponRedemption struct {
+	ID         uint         `json:"id" gorm:"primaryKey"`
+	CouponCode string       `json:"couponCode" gorm:"size:32;index"`
+	CouponID   *uint        `json:"couponId,omitempty" gorm:"index:idx_redemption_customer"`
+	CustomerID string       `json:"customerId,omitempty" gorm:"size:64;index:idx_redemption_customer"`
+	OrderID    string       `json:"orderId" gorm:"size:36;uniqueIndex"`
+	Discount   money.Amount `json:"discount"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	ReleasedAt *time.Time   `json:"releasedAt,omitempty"`
+}
+
+// StringList is stored as a JSON array.
+type StringList []string
+
+func (StringList) GormDataType() string {
+	return "text"
+}
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	return string(b), err
+}
+
+func (l *StringList) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+}
@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"order-food-api/core/money"
+	"order-food-api/core/pricing"
+)
+
+// CouponCheckReq checks a coupon against a cart before placing the order.
+type CouponCheckReq struct {
+	CustomerID string         `json:"customerId" binding:"max=64"`
+	CouponCode string         `json:"couponCode" binding:"required"`
+	Items      []OrderItemReq `json:"items" binding:"dive"`
+}
+
+type CouponDiscount struct {
+	Type pricing.Kind `json:"type"`
+	// Value is the percent off for percentage discounts and the amount
+	// off for fixed ones.
+	Value money.Amount `json:"value"`
+}
+
+type CouponCheckRes struct {
+	Code     string          `json:"code"`
+	Valid    bool            `json:"valid"`
+	Reason   string          `json:"reason,omitempty"`
+	Discount *CouponDiscount `json:"discount,omitempty"`
+	// Cart totals, set when the check included items.
+	Subtotal  *money.Amount `json:"subtotal,omitempty"`
+	Discounts *money.Amount `json:"discounts,omitempty"`
+	Total     *money.Amount `json:"total,omitempty"`
+}
@@ -1,9 +1,41 @@
 package dto
 
+type OrderItemReq struct {
+	ProductID string `json:"productId" binding:"required"`
+	Quantity  int    `json:"quantity"`
+}
+
 type OrderReq struct {
-	CouponCode string `json:"couponCode" binding:"omitempty,min=8,max=10"`
-	Items      []struct {
-		ProductID string `json:"productId" binding:"required"`
-		Quantity  int    `json:"quantity" binding:"required"`
-	} `json:"items" binding:"required"`
+	CustomerID string         `json:"customerId" binding:"max=64"`
+	CouponCode string         `json:"couponCode"`
+	Items      []OrderItemReq `json:"items" binding:"required,min=1,dive"`
+}
+
+type OrderStatusReq struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note" binding:"max=255"`
+}
+
+type CancelOrderReq struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// Operations of OrderItemsPatchReq.
+const (
+	OrderItemAdd    = "add"
+	OrderItemRemove = "remove"
+	OrderItemSet    = "set"
+)
+
+type OrderItemOp struct {
+	Op        string `json:"op" binding:"required,oneof=add remove set"`
+	ProductID string `json:"productId" binding:"required"`
+	Quantity  int    `json:"quantity"`
+}
+
+type OrderItemsPatchReq struct {
+	// Version is the order version the changes are based on, when the
+	// request has no If-Match header.
+	Version    int           `json:"version"`
+	Operations []OrderItemOp `json:"operations" binding:"required,min=1,dive"`
 }
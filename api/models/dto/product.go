@@ -0,0 +1,19 @@
+package dto
+
+import "order-food-api/core/money"
+
+// ProductInput is the body of a product create or update. The ID is
+// never taken from the body.
+type ProductInput struct {
+	Name     string            `json:"name" binding:"required,max=255"`
+	Price    money.Amount      `json:"price" binding:"gt=0"`
+	Category string            `json:"category" binding:"required"`
+	Image    ProductImageInput `json:"image"`
+}
+
+type ProductImageInput struct {
+	Thumbnail string `json:"thumbnail" binding:"omitempty,max=255,http_url"`
+	Mobile    string `json:"mobile" binding:"omitempty,max=255,http_url"`
+	Tablet    string `json:"tablet" binding:"omitempty,max=255,http_url"`
+	Desktop   string `json:"desktop" binding:"omitempty,max=255,http_url"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// IdempotencyKey stores the response to a request sent with an
+// Idempotency-Key header, so retries of the request get the same response.
+// Status is 0 while the first request is still being handled.
+type IdempotencyKey struct {
+	Key         string `gorm:"primaryKey;size:191"`
+	RequestHash string `gorm:"size:64"`
+	Status      int
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
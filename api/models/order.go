@@ -1,15 +1,89 @@
 package models
 
+import (
+	"time"
+
+	"order-food-api/core/money"
+)
+
+// Order statuses. services.Transition enforces the allowed changes.
+const (
+	OrderStatusPlaced    = "placed"
+	OrderStatusConfirmed = "confirmed"
+	OrderStatusPreparing = "preparing"
+	OrderStatusReady     = "ready"
+	OrderStatusCompleted = "completed"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
 type Order struct {
-	ID         string      `json:"id" gorm:"primaryKey"`
-	CouponCode string      `json:"couponCode"`
-	Items      []OrderItem `json:"items" gorm:"foreignKey:OrderID"`
-	Products   []Product   `json:"products" gorm:"-"`
+	ID         string       `json:"id" gorm:"primaryKey"`
+	Status     string       `json:"status" gorm:"size:16;index;default:placed"`
+	CustomerID string       `json:"customerId,omitempty" gorm:"size:64;index"`
+	CouponCode string       `json:"couponCode" gorm:"size:32;index"`
+	Total      money.Amount `json:"total"`
+	Discounts  money.Amount `json:"discounts"`
+	Items      []OrderItem  `json:"items" gorm:"foreignKey:OrderID"`
+	Products   []Product    `json:"products" gorm:"-"`
+	// Version is incremented by every change of the items, for optimistic
+	// concurrency. It is sent as the order's ETag.
+	Version      int    `json:"version" gorm:"not null;default:1"`
+	CancelReason string `json:"cancelReason,omitempty" gorm:"size:255"`
+	// Refund is the refund of a cancelled order, when preloaded.
+	Refund *Refund `json:"refund,omitempty" gorm:"foreignKey:OrderID"`
+	// History is the status changes of the order, when preloaded.
+	History   []OrderStatusChange `json:"history,omitempty" gorm:"foreignKey:OrderID"`
+	CreatedAt time.Time           `json:"createdAt" gorm:"index"`
+	UpdatedAt time.Time           `json:"updatedAt"`
 }
 
-type OrderItem struct {
+// OrderStatusChange records a status change of an order. The first change
+// of an order has an empty From.
+type OrderStatusChange struct {
 	ID        uint      `json:"-" gorm:"primaryKey"`
 	OrderID   string    `json:"-" gorm:"index"`
-	ProductID ProductID `json:"productId"`
-	Quantity  int       `json:"quantity"`
+	From      string    `json:"from" gorm:"size:16"`
+	To        string    `json:"to" gorm:"size:16"`
+	Note      string    `json:"note,omitempty" gorm:"size:255"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OrderItem keeps the product's name, category and price at the time of the
+// order, so later product changes do not alter past orders.
+type OrderItem struct {
+	ID        uint         `json:"-" gorm:"primaryKey"`
+	OrderID   string       `json:"-" gorm:"index"`
+	ProductID ProductID    `json:"productId"`
+	Quantity  int          `json:"quantity"`
+	Name      string       `json:"name"`
+	Category  string       `json:"category"`
+	UnitPrice money.Amount `json:"unitPrice"`
+	LineTotal money.Amount `json:"lineTotal"`
+	// Product is the current product, when preloaded.
+	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID;constraint:-"`
+}
+
+// SnapshotProducts returns the ordered products as they were when the order
+// was placed, from the item snapshots.
+func (o *Order) SnapshotProducts() []Product {
+	products := make([]Product, len(o.Items))
+	for i, item := range o.Items {
+		products[i] = Product{
+			ID:       item.ProductID,
+			Name:     item.Name,
+			Price:    item.UnitPrice,
+			Category: item.Category,
+		}
+	}
+	return products
+}
+
+// Refund is the amount owed back to the customer for a cancelled order.
+type Refund struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	OrderID   string       `json:"-" gorm:"size:191;uniqueIndex"`
+	Amount    money.Amount `json:"amount"`
+	Reason    string       `json:"reason,omitempty" gorm:"size:255"`
+	CreatedAt time.Time    `json:"createdAt"`
 }
@@ -1,6 +1,12 @@
 package models
 
-import "strconv"
+import (
+	"strconv"
+
+	"order-food-api/core/money"
+
+	"gorm.io/gorm"
+)
 
 type ProductID int
 
@@ -9,11 +15,15 @@ func (id ProductID) MarshalJSON() ([]byte, error) {
 }
 
 type Product struct {
-	ID       ProductID `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name     string    `json:"name"`
-	Price    float64   `json:"price"`
-	Category string    `json:"category"`
-	Image    Image     `gorm:"embedded" json:"image"`
+	ID       ProductID    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name     string       `json:"name"`
+	Price    money.Amount `json:"price"`
+	Category string       `json:"category"`
+	Image    Image        `gorm:"embedded" json:"image"`
+
+	// DeletedAt soft-deletes the product: it can no longer be listed or
+	// ordered, but the order items referring to it keep resolving.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type Image struct {
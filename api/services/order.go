@@ -0,0 +1,198 @@
+// Package services holds business rules shared by handlers that go beyond
+// a single model.
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"order-food-api/models"
+)
+
+var (
+	ErrOrderNotFound     = errors.New("order not found")
+	ErrUnknownStatus     = errors.New("unknown order status")
+	ErrIllegalTransition = errors.New("illegal order status transition")
+)
+
+// transitions lists the statuses each status can change to.
+var transitions = map[string][]string{
+	models.OrderStatusPlaced:    {models.OrderStatusConfirmed, models.OrderStatusCancelled},
+	models.OrderStatusConfirmed: {models.OrderStatusPreparing, models.OrderStatusCancelled},
+	models.OrderStatusPreparing: {models.OrderStatusReady, models.OrderStatusCancelled},
+	models.OrderStatusReady:     {models.OrderStatusCompleted},
+	models.OrderStatusCompleted: {models.OrderStatusRefunded},
+	models.OrderStatusCancelled: {models.OrderStatusRefunded},
+	models.OrderStatusRefunded:  {},
+}
+
+func IsOrderStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+func CanTransition(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// LockOrder loads an order within tx, locking its row until tx ends.
+func LockOrder(tx *gorm.DB, id string) (*models.Order, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// Transition changes the status of an order locked by LockOrder and records
+// the change.
+func Transition(tx *gorm.DB, order *models.Order, to, note string) error {
+	if !IsOrderStatus(to) {
+		return fmt.Errorf("%w: %q", ErrUnknownStatus, to)
+	}
+	if !CanTransition(order.Status, to) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, order.Status, to)
+	}
+
+	from := order.Status
+	order.Status = to
+	if err := tx.Model(order).Update("status", to).Error; err != nil {
+		return err
+	}
+	return RecordStatus(tx, order.ID, from, to, note)
+}
+
+// RecordStatus appends a status change to the history of an order.
+func RecordStatus(tx *gorm.DB, orderID, from, to, note string) error {
+	return tx.Create(&models.OrderStatusChange{OrderID: orderID, From: from, To: to, Note: note}).Error
+}
+
+// UpdateOrderStatus changes the status of an order in its own transaction.
+// Changing it to cancelled cancels the order as CancelOrder does, and to
+// refunded refunds it as a cancellation would have.
+func UpdateOrderStatus(db *gorm.DB, id, to, note string) (*models.Order, error) {
+	var order *models.Order
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if order, err = LockOrder(tx, id); err != nil {
+			return err
+		}
+		switch to {
+		case models.OrderStatusCancelled:
+			return cancel(tx, order, note)
+		case models.OrderStatusRefunded:
+			return refund(tx, order, note)
+		}
+		return Transition(tx, order, to, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// CancelOrder cancels an order that is not yet ready, in one transaction:
+// the reason is recorded, the coupon redemption of the order is released
+// back to its campaign and a refund of the order total is created.
+func CancelOrder(db *gorm.DB, id, reason string) (*models.Order, error) {
+	var order *models.Order
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if order, err = LockOrder(tx, id); err != nil {
+			return err
+		}
+		return cancel(tx, order, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func cancel(tx *gorm.DB, order *models.Order, reason string) error {
+	if err := Transition(tx, order, models.OrderStatusCancelled, reason); err != nil {
+		return err
+	}
+
+	order.CancelReason = reason
+	if err := tx.Model(order).Update("cancel_reason", reason).Error; err != nil {
+		return err
+	}
+	return refundTotal(tx, order, reason)
+}
+
+// refund marks a completed or cancelled order refunded. A cancelled order
+// was refunded when it was cancelled; a completed one is refunded now.
+func refund(tx *gorm.DB, order *models.Order, reason string) error {
+	if err := Transition(tx, order, models.OrderStatusRefunded, reason); err != nil {
+		return err
+	}
+	return refundTotal(tx, order, reason)
+}
+
+// refundTotal releases the coupon redemption of an order and creates a
+// refund of its total, unless the order already has one.
+func refundTotal(tx *gorm.DB, order *models.Order, reason string) error {
+	if err := releaseRedemption(tx, order.ID); err != nil {
+		return err
+	}
+
+	var existing models.Refund
+	err := tx.Where("order_id = ?", order.ID).Take(&existing).Error
+	if err == nil {
+		order.Refund = &existing
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	order.Refund = &models.Refund{OrderID: order.ID, Amount: order.Total, Reason: reason}
+	return tx.Create(order.Refund).Error
+}
+
+// releaseRedemption gives the coupon use of an order back to its campaign.
+func releaseRedemption(tx *gorm.DB, orderID string) error {
+	var redemption models.CouponRedemption
+	err := tx.Where("order_id = ? AND released_at IS NULL", orderID).Take(&redemption).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&redemption).Update("released_at", time.Now()).Error; err != nil {
+		return err
+	}
+	if redemption.CouponID == nil {
+		return nil
+	}
+	return tx.Model(&models.Coupon{}).
+		Where("id = ? AND redemptions > 0", *redemption.CouponID).
+		UpdateColumn("redemptions", gorm.Expr("redemptions - 1")).Error
+}
+
+// BackfillItemSnapshots fills the snapshot of order items stored before
+// items kept their product's name, category and price, from the products
+// as they are now, deleted ones included. Items that already have a
+// snapshot are left alone, so it is safe to run on every start.
+func BackfillItemSnapshots(db *gorm.DB) (int64, error) {
+	res := db.Exec(`UPDATE order_items
+		JOIN products ON products.id = order_items.product_id
+		SET order_items.name = products.name,
+			order_items.category = products.category,
+			order_items.unit_price = products.price,
+			order_items.line_total = products.price * order_items.quantity
+		WHERE order_items.name = '' AND order_items.unit_price = 0`)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"order-food-api/core/money"
+	"order-food-api/internal/testdb"
+	"order-food-api/models"
+)
+
+// redeemedOrder stores an order in status whose coupon use is counted by a
+// campaign, removed when the test ends.
+func redeemedOrder(t *testing.T, db *gorm.DB, status string) (*models.Order, *models.Coupon) {
+	t.Helper()
+	campaign := &models.Coupon{Code: "RF" + uuid.NewString()[:8], Redemptions: 1, MaxRedemptions: 1, Active: true}
+	order := &models.Order{ID: uuid.NewString(), Status: status, Version: 1, Total: money.FromCents(1250), CouponCode: campaign.Code}
+	if err := db.Create(campaign).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatal(err)
+	}
+	redemption := &models.CouponRedemption{CouponCode: campaign.Code, CouponID: &campaign.ID, OrderID: order.ID}
+	if err := db.Create(redemption).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Where("order_id = ?", order.ID).Delete(&models.Refund{})
+		db.Where("order_id = ?", order.ID).Delete(&models.OrderStatusChange{})
+		db.Delete(redemption)
+		db.Delete(order)
+		db.Delete(campaign)
+	})
+	return order, campaign
+}
+
+func TestRefundCompletedOrder(t *testing.T) {
+	db := testdb.Open(t)
+	order, campaign := redeemedOrder(t, db, models.OrderStatusCompleted)
+
+	updated, err := UpdateOrderStatus(db, order.ID, models.OrderStatusRefunded, "cold food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Refund == nil || updated.Refund.Amount != order.Total {
+		t.Fatalf("refund = %+v, want the order total %s", updated.Refund, order.Total)
+	}
+
+	var refunds int64
+	db.Model(&models.Refund{}).Where("order_id = ?", order.ID).Count(&refunds)
+	if refunds != 1 {
+		t.Fatalf("%d refunds stored, want 1", refunds)
+	}
+	var redemption models.CouponRedemption
+	db.Where("order_id = ?", order.ID).Take(&redemption)
+	if redemption.ReleasedAt == nil {
+		t.Fatal("coupon redemption not released")
+	}
+	db.First(campaign, campaign.ID)
+	if campaign.Redemptions != 0 {
+		t.Fatalf("campaign redemptions = %d, want 0", campaign.Redemptions)
+	}
+}
+
+func TestRefundCancelledOrderKeepsItsRefund(t *testing.T) {
+	db := testdb.Open(t)
+	order, campaign := redeemedOrder(t, db, models.OrderStatusPlaced)
+
+	if _, err := CancelOrder(db, order.ID, "changed my mind"); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := UpdateOrderStatus(db, order.ID, models.OrderStatusRefunded, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Refund == nil || updated.Refund.Reason != "changed my mind" {
+		t.Fatalf("refund = %+v, want the one created on cancellation", updated.Refund)
+	}
+
+	var refunds int64
+	db.Model(&models.Refund{}).Where("order_id = ?", order.ID).Count(&refunds)
+	if refunds != 1 {
+		t.Fatalf("%d refunds stored, want 1", refunds)
+	}
+	db.First(campaign, campaign.ID)
+	if campaign.Redemptions != 0 {
+		t.Fatalf("campaign redemptions = %d, want 0", campaign.Redemptions)
+	}
+}
+
+func TestBackfillItemSnapshots(t *testing.T) {
+	db := testdb.Open(t)
+	product := &models.Product{Name: "Backfill Tart", Price: money.FromCents(350), Category: "Tart"}
+	if err := db.Create(product).Error; err != nil {
+		t.Fatal(err)
+	}
+	order := &models.Order{ID: uuid.NewString(), Status: models.OrderStatusPlaced, Version: 1}
+	if err := db.Create(order).Error; err != nil {
+		t.Fatal(err)
+	}
+	// An item stored before snapshots, of a product deleted since.
+	item := &models.OrderItem{OrderID: order.ID, ProductID: product.ID, Quantity: 2}
+	if err := db.Create(item).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Delete(item)
+		db.Delete(order)
+		db.Unscoped().Delete(product)
+	})
+
+	if _, err := BackfillItemSnapshots(db); err != nil {
+		t.Fatal(err)
+	}
+	var got models.OrderItem
+	if err := db.First(&got, item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != product.Name || got.Category != product.Category ||
+		got.UnitPrice != product.Price || got.LineTotal != money.FromCents(700) {
+		t.Fatalf("item = %+v, want the snapshot of %+v for 2", got, product)
+	}
+}